@@ -0,0 +1,279 @@
+// Package app wires the configuration, clients, repositories and controllers
+// of the service together. Nothing is read from package level state, so the
+// full router can be built against test doubles and several instances can
+// run in one process.
+package app
+
+import (
+	"net/http"
+
+	"github.com/aliftoriq/go-crud/config"
+	"github.com/aliftoriq/go-crud/controllers"
+	"github.com/aliftoriq/go-crud/health"
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/aliftoriq/go-crud/lifecycle"
+	"github.com/aliftoriq/go-crud/logging"
+	"github.com/aliftoriq/go-crud/metrics"
+	"github.com/aliftoriq/go-crud/middleware"
+	"github.com/aliftoriq/go-crud/password"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+	"github.com/aliftoriq/go-crud/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+	swaggerfiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gorm.io/gorm"
+)
+
+// Deps are what an App is built on. Repositories and the scanner that are
+// left nil are created from the clients and the configuration, so a test can
+// replace any of them and leave out the clients nothing uses.
+type Deps struct {
+	DB    *gorm.DB
+	Redis *redis.Client
+	// Minio is only used by the minio storage backend.
+	Minio *minio.Client
+	// Tracing is flushed and shut down when the App stops; nil when tracing
+	// is off.
+	Tracing *sdktrace.TracerProvider
+
+	Repos   Repositories
+	Scanner scanner.Scanner
+}
+
+// Repositories are the data access of an App.
+type Repositories struct {
+	User       repositories.UserRepository
+	Article    repositories.ArticleRepository
+	Comment    repositories.CommentRepository
+	Engagement repositories.EngagementRepository
+	Media      repositories.MediaRepository
+	Cache      repositories.CacheRepository
+	Counter    repositories.CounterRepository
+	View       repositories.ViewRepository
+	Bucket     repositories.BucketRepository
+}
+
+// App is one instance of the service.
+type App struct {
+	Config  *config.Config
+	Repos   Repositories
+	Scanner scanner.Scanner
+	Router  *gin.Engine
+	Server  *http.Server
+	// Health reports the readiness of the App on /readyz.
+	Health *health.Checker
+	// Lifecycle starts and stops the subsystems. Subsystems added to an App
+	// append their hooks to it.
+	Lifecycle *lifecycle.Lifecycle
+
+	serveErr chan error
+}
+
+// New builds an App with all of its routes. The configuration must have
+// passed config.Load or Validate. The App takes over the clients in deps and
+// closes them when it stops.
+func New(cfg *config.Config, deps Deps) *App {
+	a := &App{
+		Config:    cfg,
+		Repos:     deps.Repos,
+		Scanner:   deps.Scanner,
+		Lifecycle: &lifecycle.Lifecycle{},
+		serveErr:  make(chan error, 1),
+	}
+	a.fillRepositories(deps)
+	if a.Scanner == nil {
+		a.Scanner = newScanner(cfg.Scanner)
+	}
+
+	a.Health = a.newChecker(deps)
+
+	a.Router = gin.New()
+	// Lets handlers pass c as the context of the request, so the calls they
+	// make join its trace and are cancelled with it
+	a.Router.ContextWithFallback = true
+	// Recovery comes last so panics are counted, logged and answered with a
+	// problem like any other error
+	a.Router.Use(
+		logging.RequestIDMiddleware(),
+		tracing.Middleware(a.Config.Tracing.ServiceName),
+		logging.Middleware(),
+		metrics.Middleware(),
+		problem.Middleware(),
+		logging.Recovery(),
+	)
+	a.Router.NoRoute(problem.NoRoute)
+	a.routes()
+	a.Server = a.newServer()
+
+	// Stopped in reverse: readiness fails first, then requests drain, then
+	// the jobs end, then the clients close and the last spans are flushed
+	if deps.Tracing != nil {
+		a.Lifecycle.Append(tracingHook(deps.Tracing))
+	}
+	for _, hook := range clientHooks(deps.DB, deps.Redis) {
+		a.Lifecycle.Append(hook)
+	}
+	a.Lifecycle.Append(a.jobsHook())
+	a.Lifecycle.Append(a.serverHook())
+	a.Lifecycle.Append(a.drainHook())
+
+	return a
+}
+
+func (a *App) fillRepositories(deps Deps) {
+	r := &a.Repos
+	if r.User == nil {
+		r.User = repositories.NewUserRepository(deps.DB)
+	}
+	if r.Article == nil {
+		r.Article = repositories.NewArticleRepository(deps.DB)
+	}
+	if r.Comment == nil {
+		r.Comment = repositories.NewCommentRepository(deps.DB)
+	}
+	if r.Engagement == nil {
+		r.Engagement = repositories.NewEngagementRepository(deps.DB)
+	}
+	if r.Media == nil {
+		r.Media = repositories.NewMediaRepository(deps.DB)
+	}
+	if r.Cache == nil {
+		r.Cache = repositories.NewCacheRepository(deps.Redis)
+	}
+	if r.Counter == nil {
+		r.Counter = repositories.NewCounterRepository(deps.DB, deps.Redis)
+	}
+	if r.View == nil {
+		r.View = repositories.NewViewRepository(deps.Redis)
+	}
+	if r.Bucket == nil {
+		r.Bucket = newBucketRepository(a.Config.Storage, deps.Minio)
+	}
+}
+
+func newBucketRepository(cfg config.Storage, client *minio.Client) repositories.BucketRepository {
+	var bucketRepo repositories.BucketRepository
+	switch cfg.Backend {
+	case "local":
+		bucketRepo = repositories.NewLocalBucketRepository(cfg.Path)
+	case "memory":
+		bucketRepo = repositories.NewMemoryBucketRepository()
+	default:
+		bucketRepo = repositories.NewBucketRepository(client)
+	}
+	return metrics.InstrumentBucket(cfg.Backend, bucketRepo)
+}
+
+// newScanner returns the scanner uploads must pass before they are served.
+func newScanner(cfg config.Scanner) scanner.Scanner {
+	switch cfg.Backend {
+	case "clamav":
+		return scanner.NewClamAV(cfg.ClamAVAddr, cfg.ClamAVTimeout)
+	case "fake":
+		return scanner.Fake{}
+	default:
+		return scanner.NoOp{}
+	}
+}
+
+// newPasswords returns how passwords are hashed and which new passwords are
+// accepted.
+func newPasswords(cfg config.Passwords) (password.Hasher, password.Policy) {
+	hasher := password.Hasher{
+		Algorithm:  cfg.Hash,
+		BcryptCost: cfg.BcryptCost,
+		Argon2: password.Argon2Params{
+			Time:    uint32(cfg.Argon2Time),
+			Memory:  uint32(cfg.Argon2Memory),
+			Threads: uint8(cfg.Argon2Threads),
+		},
+	}
+
+	policy := password.Policy{
+		MinLength:  cfg.MinLength,
+		MinEntropy: cfg.MinEntropy,
+	}
+	if cfg.BreachedDir != "" {
+		policy.Breached = &password.Breached{Dir: cfg.BreachedDir}
+	}
+	return hasher, policy
+}
+
+// routes creates the controllers and registers their routes.
+func (a *App) routes() {
+	cfg := a.Config
+	r := a.Router
+	repos := a.Repos
+
+	// Both were checked by config.Validate
+	variants, _ := images.ParseVariants(cfg.Uploads.ImageVariants)
+	quotas, _ := config.ParseQuotas(cfg.Uploads.StorageQuotas)
+
+	middlewareAuth := middleware.NewAuth(repos.User, cfg.Auth.Secret)
+
+	hasher, policy := newPasswords(cfg.Passwords)
+	userController := controllers.NewUsersController(repos.User, cfg.Auth.Secret, hasher, policy)
+	arController := controllers.NewArticlesController(repos.Article, repos.Cache, repos.Counter, repos.View)
+	commentController := controllers.NewCommentsController(repos.Comment, repos.Cache)
+	engagementController := controllers.NewEngagementController(repos.Engagement, repos.Counter)
+	bucketController := controllers.NewBucketControllers(repos.Bucket, repos.Media, repos.Cache, variants, a.Scanner, cfg.Storage.Bucket, cfg.Uploads, quotas)
+	mediaController := controllers.NewMediaController(repos.Media, repos.Article, repos.Bucket, repos.Cache, repos.Counter, repos.View, cfg.Storage.Bucket, quotas)
+	healthController := controllers.NewHealthController(a.Health)
+
+	// add swagger
+	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
+
+	r.GET("/healthz", healthController.Healthz)
+	r.GET("/readyz", healthController.Readyz)
+	r.GET("/metrics", metrics.Handler())
+
+	r.POST("/signup", userController.Signup)
+	r.POST("/login", userController.Login)
+	r.GET("/validate", middlewareAuth.RequireAuth, userController.Validate)
+
+	r.GET("/users/:id", middlewareAuth.RequireAuth, userController.GetUser)
+	r.PUT("/users/:id", middlewareAuth.RequireAuth, userController.UpdateUser)
+	r.DELETE("/users/:id", middlewareAuth.RequireAuth, userController.DeleteUser)
+
+	r.POST("/articles", middlewareAuth.RequireAuth, arController.CreateArticle)
+	r.PUT("/articles/:id", middlewareAuth.RequireAuth, arController.UpdateArticle)
+	r.GET("/articles", middlewareAuth.RequireAuth, arController.GetArticles)
+	r.GET("/articles/trending", middlewareAuth.RequireAuth, arController.GetTrendingArticles)
+	r.GET("/articles/:id", middlewareAuth.RequireAuth, arController.GetArticleByID)
+	r.DELETE("/articles/:id", middlewareAuth.RequireAuth, arController.DeleteArticle)
+
+	r.POST("/articles/:id/comments", middlewareAuth.RequireAuth, commentController.CreateComment)
+	r.GET("/articles/:id/comments", middlewareAuth.RequireAuth, commentController.GetComments)
+	r.PUT("/articles/:id/comments/:commentId", middlewareAuth.RequireAuth, commentController.UpdateComment)
+	r.DELETE("/articles/:id/comments/:commentId", middlewareAuth.RequireAuth, commentController.DeleteComment)
+
+	r.GET("/articles/:id/media", middlewareAuth.RequireAuth, mediaController.GetArticleMedia)
+	r.POST("/articles/:id/media", middlewareAuth.RequireAuth, mediaController.AttachMedia)
+	r.DELETE("/articles/:id/media/:name", middlewareAuth.RequireAuth, mediaController.DetachMedia)
+	r.DELETE("/articles/:id/purge", middlewareAuth.RequireAuth, mediaController.PurgeArticle)
+
+	r.PUT("/articles/:id/reactions/:type", middlewareAuth.RequireAuth, engagementController.AddReaction)
+	r.DELETE("/articles/:id/reactions/:type", middlewareAuth.RequireAuth, engagementController.RemoveReaction)
+	r.PUT("/articles/:id/bookmark", middlewareAuth.RequireAuth, engagementController.AddBookmark)
+	r.DELETE("/articles/:id/bookmark", middlewareAuth.RequireAuth, engagementController.RemoveBookmark)
+	r.GET("/me/bookmarks", middlewareAuth.RequireAuth, engagementController.GetBookmarks)
+	r.GET("/me/media", middlewareAuth.RequireAuth, mediaController.GetMyMedia)
+
+	r.POST("/upload-image", middlewareAuth.RequireAuth, bucketController.UploadImageToMinio)
+	r.POST("/uploads/presign", middlewareAuth.RequireAuth, bucketController.PresignUpload)
+	r.POST("/uploads/complete", middlewareAuth.RequireAuth, bucketController.CompleteUpload)
+	r.POST("/uploads/multipart", middlewareAuth.RequireAuth, bucketController.CreateMultipartUpload)
+	r.GET("/uploads/multipart/:uploadId", middlewareAuth.RequireAuth, bucketController.GetMultipartUpload)
+	r.PUT("/uploads/multipart/:uploadId/parts/:partNumber", middlewareAuth.RequireAuth, bucketController.UploadPart)
+	r.POST("/uploads/multipart/:uploadId/complete", middlewareAuth.RequireAuth, bucketController.CompleteMultipartUpload)
+	r.DELETE("/uploads/multipart/:uploadId", middlewareAuth.RequireAuth, bucketController.AbortMultipartUpload)
+	r.GET("/image/:id", middlewareAuth.RequireAuth, bucketController.GetImage)
+	r.HEAD("/image/:id", middlewareAuth.RequireAuth, bucketController.GetImage)
+	r.GET("/image/:id/presign", middlewareAuth.RequireAuth, bucketController.PresignImage)
+	r.DELETE("/image/:id", middlewareAuth.RequireAuth, bucketController.DeleteImage)
+}
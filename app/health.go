@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliftoriq/go-crud/health"
+	"github.com/aliftoriq/go-crud/lifecycle"
+)
+
+// newChecker checks the clients in deps for readiness. Clients left out,
+// like MinIO with another storage backend, are not checked.
+func (a *App) newChecker(deps Deps) *health.Checker {
+	cfg := a.Config.Health
+	checker := &health.Checker{}
+
+	if deps.DB != nil {
+		checker.Add("postgres", cfg.PostgresTimeout, func(ctx context.Context) error {
+			sqlDB, err := deps.DB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		})
+	}
+
+	if deps.Redis != nil {
+		checker.Add("redis", cfg.RedisTimeout, func(ctx context.Context) error {
+			return deps.Redis.Ping(ctx).Err()
+		})
+	}
+
+	if deps.Minio != nil {
+		bucket := a.Config.Storage.Bucket
+		checker.Add("minio", cfg.MinioTimeout, func(ctx context.Context) error {
+			exists, err := deps.Minio.BucketExists(ctx, bucket)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("bucket %s does not exist", bucket)
+			}
+			return nil
+		})
+	}
+
+	return checker
+}
+
+// drainHook makes /readyz fail as soon as the App starts stopping, then keeps
+// serving for the shutdown delay so load balancers stop sending requests
+// before the server closes.
+func (a *App) drainHook() lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "readiness",
+		OnStop: func(ctx context.Context) error {
+			a.Health.Drain()
+
+			select {
+			case <-time.After(a.Config.Server.ShutdownDelay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aliftoriq/go-crud/controllers"
+	"github.com/aliftoriq/go-crud/jobs"
+	"github.com/aliftoriq/go-crud/lifecycle"
+)
+
+// jobsHook runs the background jobs from start to stop. Stopping waits for
+// running jobs to return.
+func (a *App) jobsHook() lifecycle.Hook {
+	var (
+		cancel  context.CancelFunc
+		running sync.WaitGroup
+	)
+
+	return lifecycle.Hook{
+		Name: "background jobs",
+		OnStart: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			a.startJobs(ctx, &running)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			return wait(ctx, &running)
+		},
+	}
+}
+
+func (a *App) startJobs(ctx context.Context, running *sync.WaitGroup) {
+	cfg := a.Config
+	repos := a.Repos
+
+	goJob := func(job func()) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			job()
+		}()
+	}
+	every := func(name string, interval time.Duration, fn func(ctx context.Context) error) {
+		goJob(func() { jobs.Every(ctx, name, interval, fn) })
+	}
+
+	// Fold the engagement counters buffered in Redis into Postgres
+	every("flush article counters", 30*time.Second, repos.Counter.Flush)
+	// Free the parts of multipart uploads that were never completed
+	every("abort stale uploads", time.Hour,
+		jobs.AbortStaleUploads(repos.Bucket, cfg.Storage.Bucket, controllers.MultipartUploadExpiry))
+	// Report, and optionally delete, objects and media that lost each other
+	if interval := cfg.Orphans.GCInterval; interval > 0 {
+		every("collect orphans", interval,
+			jobs.CollectOrphansJob(repos.Media, repos.Bucket, cfg.Storage.Bucket, jobs.OrphanOptions{
+				GracePeriod: cfg.Orphans.GracePeriod,
+				Delete:      cfg.Orphans.GCDelete,
+			}))
+	}
+	// Retry the scans of uploads that could not be scanned when they were stored
+	every("scan pending media", time.Minute,
+		jobs.ScanPendingMedia(repos.Media, repos.Bucket, a.Scanner, cfg.Storage.Bucket))
+	// Record media for images uploaded before media were recorded, so they
+	// are scanned and served again, and the sizes of media uploaded before
+	// storage quotas existed
+	goJob(func() {
+		if err := jobs.RegisterLegacyObjects(ctx, repos.Media, repos.Bucket, cfg.Storage.Bucket); err != nil {
+			slog.ErrorContext(ctx, "failed to register legacy images", "error", err)
+		}
+		if err := jobs.BackfillMediaSizes(ctx, repos.Media, repos.Bucket, cfg.Storage.Bucket); err != nil {
+			slog.ErrorContext(ctx, "failed to backfill media sizes", "error", err)
+		}
+	})
+}
+
+// wait waits for the group until ctx is done.
+func wait(ctx context.Context, group *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
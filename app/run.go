@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/aliftoriq/go-crud/lifecycle"
+	"github.com/redis/go-redis/v9"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gorm.io/gorm"
+)
+
+// Run starts the App and blocks until ctx is done or the HTTP server fails.
+// It then stops the App, giving in-flight requests and running jobs up to
+// the shutdown timeout to finish.
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Lifecycle.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case runErr = <-a.serveErr:
+		slog.Error("server failed, shutting down", "error", runErr)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), a.Config.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := a.Lifecycle.Stop(stopCtx); err != nil {
+		if runErr != nil {
+			slog.Error("failed to stop", "error", err)
+			return runErr
+		}
+		return err
+	}
+	return runErr
+}
+
+// newServer returns the HTTP server of the App.
+func (a *App) newServer() *http.Server {
+	cfg := a.Config.Server
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           a.Router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// serverHook listens on start, so a port in use fails the start, and drains
+// in-flight requests on stop.
+func (a *App) serverHook() lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "http server",
+		OnStart: func(context.Context) error {
+			listener, err := net.Listen("tcp", a.Server.Addr)
+			if err != nil {
+				return err
+			}
+			slog.Info("listening", "addr", listener.Addr().String())
+
+			go func() {
+				if err := a.Server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+					a.serveErr <- err
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return a.Server.Shutdown(ctx)
+		},
+	}
+}
+
+// tracingHook flushes the spans that were not exported yet when the App
+// stops.
+func tracingHook(provider *sdktrace.TracerProvider) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name:   "tracing",
+		OnStop: provider.Shutdown,
+	}
+}
+
+// clientHooks close the clients the App was given when it stops, after
+// everything that uses them.
+func clientHooks(db *gorm.DB, redisClient *redis.Client) []lifecycle.Hook {
+	var hooks []lifecycle.Hook
+
+	if db != nil {
+		hooks = append(hooks, lifecycle.Hook{
+			Name: "postgres",
+			OnStop: func(context.Context) error {
+				sqlDB, err := db.DB()
+				if err != nil {
+					return err
+				}
+				return sqlDB.Close()
+			},
+		})
+	}
+
+	if redisClient != nil {
+		hooks = append(hooks, lifecycle.Hook{
+			Name: "redis",
+			OnStop: func(context.Context) error {
+				return redisClient.Close()
+			},
+		})
+	}
+
+	return hooks
+}
@@ -0,0 +1,349 @@
+// Package config loads the settings of the service.
+//
+// Settings come from, in order of precedence:
+//
+//  1. environment variables, including those in an optional .env file
+//  2. the YAML or TOML file named by CONFIG_FILE
+//  3. the defaults of Default
+//
+// Every setting has a key in the file, e.g. storage.backend, and an
+// environment variable, e.g. STORAGE_BACKEND.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/joho/godotenv"
+)
+
+// MaxPresignExpiry is the longest expiry S3 accepts for presigned URLs.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// Config holds all settings. Fields are tagged with their key in the config
+// file and their environment variable; Write hides the secret fields.
+type Config struct {
+	Server    Server    `config:"server"`
+	Log       Log       `config:"log"`
+	Database  Database  `config:"database"`
+	Redis     Redis     `config:"redis"`
+	Auth      Auth      `config:"auth"`
+	Passwords Passwords `config:"passwords"`
+	Storage   Storage   `config:"storage"`
+	Minio     Minio     `config:"minio"`
+	Uploads   Uploads   `config:"uploads"`
+	Scanner   Scanner   `config:"scanner"`
+	Orphans   Orphans   `config:"orphans"`
+	Health    Health    `config:"health"`
+	Tracing   Tracing   `config:"tracing"`
+}
+
+type Server struct {
+	Port string `config:"port" env:"PORT"`
+	// The timeouts of the HTTP server; 0 means none.
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `config:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `config:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `config:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long in-flight requests and background jobs get
+	// to finish after SIGTERM or SIGINT.
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay keeps serving, while /readyz reports not ready, before the
+	// server stops accepting connections, so load balancers can notice. It is
+	// part of the shutdown timeout.
+	ShutdownDelay time.Duration `config:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+}
+
+type Log struct {
+	// Format is json or text.
+	Format string `config:"format" env:"LOG_FORMAT"`
+	// Level is debug, info, warn or error.
+	Level string `config:"level" env:"LOG_LEVEL"`
+}
+
+type Database struct {
+	// DSN is a PostgreSQL connection string, as key=value pairs or a URL.
+	DSN string `config:"dsn" env:"DB" secret:"dsn"`
+}
+
+type Redis struct {
+	Addr     string `config:"addr" env:"REDIS_ADDR"`
+	Password string `config:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `config:"db" env:"REDIS_DB"`
+}
+
+type Auth struct {
+	// Secret signs the JWT login tokens.
+	Secret string `config:"secret" env:"SECRET" secret:"true"`
+}
+
+type Passwords struct {
+	// MinLength is the least number of characters of new passwords.
+	MinLength int `config:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	// MinEntropy is the least estimated strength of new passwords in bits;
+	// 0 turns the estimate off.
+	MinEntropy float64 `config:"min_entropy" env:"PASSWORD_MIN_ENTROPY"`
+	// BreachedDir holds the Pwned Passwords range files that new passwords
+	// are looked up in; empty turns the lookup off.
+	BreachedDir string `config:"breached_dir" env:"PASSWORD_BREACHED_DIR"`
+	// Hash is bcrypt or argon2id. Passwords hashed with another algorithm or
+	// other parameters are hashed again when their users log in.
+	Hash       string `config:"hash" env:"PASSWORD_HASH"`
+	BcryptCost int    `config:"bcrypt_cost" env:"BCRYPT_COST"`
+	// The parameters of argon2id; the memory is in KiB.
+	Argon2Time    int `config:"argon2_time" env:"ARGON2_TIME"`
+	Argon2Memory  int `config:"argon2_memory" env:"ARGON2_MEMORY"`
+	Argon2Threads int `config:"argon2_threads" env:"ARGON2_THREADS"`
+}
+
+type Storage struct {
+	// Backend is minio, local or memory.
+	Backend string `config:"backend" env:"STORAGE_BACKEND"`
+	// Path is the directory of the local backend.
+	Path   string `config:"path" env:"STORAGE_PATH"`
+	Bucket string `config:"bucket" env:"BUCKETNAME"`
+}
+
+type Minio struct {
+	Endpoint  string `config:"endpoint" env:"ENDPOINT"`
+	AccessKey string `config:"access_key" env:"ACCESKEY" secret:"true"`
+	SecretKey string `config:"secret_key" env:"SECRETKEY" secret:"true"`
+}
+
+type Uploads struct {
+	// MaxSize is the largest accepted image upload in bytes.
+	MaxSize int64 `config:"max_size" env:"MAX_UPLOAD_SIZE"`
+	// MaxResumableSize is the largest accepted multipart upload in bytes.
+	MaxResumableSize int64 `config:"max_resumable_size" env:"MAX_RESUMABLE_UPLOAD_SIZE"`
+	// PresignExpiry is the default lifetime of presigned URLs.
+	PresignExpiry time.Duration `config:"presign_expiry" env:"PRESIGN_EXPIRY"`
+	// StripMetadata removes EXIF and XMP metadata from uploaded images.
+	StripMetadata bool `config:"strip_metadata" env:"STRIP_IMAGE_METADATA"`
+	// ImageVariants is parsed by images.ParseVariants.
+	ImageVariants string `config:"image_variants" env:"IMAGE_VARIANTS"`
+	// StorageQuotas is parsed by ParseQuotas.
+	StorageQuotas string `config:"storage_quotas" env:"STORAGE_QUOTAS"`
+}
+
+type Scanner struct {
+	// Backend is none, clamav or fake.
+	Backend       string        `config:"backend" env:"SCANNER"`
+	ClamAVAddr    string        `config:"clamav_addr" env:"CLAMAV_ADDR"`
+	ClamAVTimeout time.Duration `config:"clamav_timeout" env:"CLAMAV_TIMEOUT"`
+}
+
+// Health holds how long each readiness check may take.
+type Health struct {
+	PostgresTimeout time.Duration `config:"postgres_timeout" env:"HEALTH_POSTGRES_TIMEOUT"`
+	RedisTimeout    time.Duration `config:"redis_timeout" env:"HEALTH_REDIS_TIMEOUT"`
+	MinioTimeout    time.Duration `config:"minio_timeout" env:"HEALTH_MINIO_TIMEOUT"`
+}
+
+type Tracing struct {
+	// Exporter is none, otlp or stdout.
+	Exporter string `config:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the URL of an OTLP/HTTP receiver, like an OpenTelemetry
+	// collector, for the otlp exporter.
+	Endpoint    string `config:"endpoint" env:"TRACING_ENDPOINT"`
+	ServiceName string `config:"service_name" env:"TRACING_SERVICE_NAME"`
+	// SampleRatio is the share of new traces that is recorded, from 0 to 1.
+	// Requests that continue a sampled trace are always recorded.
+	SampleRatio float64 `config:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type Orphans struct {
+	// GCInterval is how often orphans are collected; 0 turns it off.
+	GCInterval time.Duration `config:"gc_interval" env:"ORPHAN_GC_INTERVAL"`
+	// GCDelete makes the scheduled collection delete orphans instead of only
+	// reporting them.
+	GCDelete bool `config:"gc_delete" env:"ORPHAN_GC_DELETE"`
+	// GracePeriod protects recently written objects from deletion. It should
+	// be longer than the presign expiry.
+	GracePeriod time.Duration `config:"grace_period" env:"ORPHAN_GRACE_PERIOD"`
+}
+
+// Default returns the settings used for everything that is not configured.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              "8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Log: Log{
+			Format: "json",
+			Level:  "info",
+		},
+		Redis: Redis{Addr: "localhost:6379"},
+		Passwords: Passwords{
+			MinLength:     8,
+			MinEntropy:    40,
+			Hash:          "bcrypt",
+			BcryptCost:    10,
+			Argon2Time:    3,
+			Argon2Memory:  64 * 1024,
+			Argon2Threads: 4,
+		},
+		Storage: Storage{
+			Backend: "minio",
+			Path:    "./storage",
+		},
+		Uploads: Uploads{
+			MaxSize:          10 << 20,
+			MaxResumableSize: 100 << 20,
+			PresignExpiry:    15 * time.Minute,
+			StripMetadata:    true,
+			ImageVariants:    images.DefaultVariants,
+			StorageQuotas:    DefaultStorageQuotas,
+		},
+		Scanner: Scanner{
+			Backend:       "none",
+			ClamAVAddr:    "localhost:3310",
+			ClamAVTimeout: 30 * time.Second,
+		},
+		Orphans: Orphans{
+			GCInterval:  24 * time.Hour,
+			GracePeriod: 24 * time.Hour,
+		},
+		Health: Health{
+			PostgresTimeout: 2 * time.Second,
+			RedisTimeout:    time.Second,
+			MinioTimeout:    2 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "go-crud",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load reads the configuration as described in the package documentation and
+// validates it. When only the validation fails, the configuration is returned
+// together with a *ValidationError.
+func Load() (*Config, error) {
+	// Variables already set in the environment win over the .env file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("config: .env: %w", err)
+	}
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadEnv overrides settings with the environment variables that are set.
+func (cfg *Config) loadEnv() error {
+	for _, s := range cfg.settings() {
+		raw, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			return fmt.Errorf("config: %s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// setting is one field of Config.
+type setting struct {
+	key    string // e.g. storage.backend
+	env    string
+	secret string
+	value  reflect.Value
+}
+
+// settings lists every setting in declaration order.
+func (cfg *Config) settings() []setting {
+	var settings []setting
+
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionKey := sections.Type().Field(i).Tag.Get("config")
+
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			settings = append(settings, setting{
+				key:    sectionKey + "." + field.Tag.Get("config"),
+				env:    field.Tag.Get("env"),
+				secret: field.Tag.Get("secret"),
+				value:  section.Field(j),
+			})
+		}
+	}
+
+	return settings
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses raw into the setting according to its type.
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if s.value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, want e.g. 15m or 24h", raw)
+		}
+		s.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, want true or false", raw)
+		}
+		s.value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		s.value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		s.value.SetFloat(f)
+	default:
+		panic("config: unsupported setting type " + s.value.Type().String())
+	}
+	return nil
+}
+
+// String formats the setting the way set parses it.
+func (s setting) String() string {
+	if s.value.Type() == durationType {
+		return time.Duration(s.value.Int()).String()
+	}
+	return fmt.Sprint(s.value.Interface())
+}
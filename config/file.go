@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile overrides settings with those in a YAML (.yaml, .yml) or TOML
+// (.toml) file. Both have a table per section:
+//
+//	storage:
+//	  backend: local
+//	  bucket: images
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	var file map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	case ".toml":
+		err = toml.Unmarshal(data, &file)
+	default:
+		return fmt.Errorf("config: %s: unknown format %q, want .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	values := make(map[string]interface{})
+	for sectionKey, section := range file {
+		fields, ok := section.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("config: %s: %s must be a table of settings", path, sectionKey)
+		}
+		for key, value := range fields {
+			values[sectionKey+"."+key] = value
+		}
+	}
+
+	for _, s := range cfg.settings() {
+		value, ok := values[s.key]
+		if !ok {
+			continue
+		}
+		delete(values, s.key)
+
+		if err := s.set(formatValue(value)); err != nil {
+			return fmt.Errorf("config: %s: %s: %w", path, s.key, err)
+		}
+	}
+
+	if len(values) > 0 {
+		unknown := make([]string, 0, len(values))
+		for key := range values {
+			unknown = append(unknown, key)
+		}
+		sort.Strings(unknown)
+		return fmt.Errorf("config: %s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// formatValue turns a decoded value back into text for setting.set, so files
+// and environment variables are parsed the same way.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in the output of Write.
+const redacted = "REDACTED"
+
+// Write writes the settings to w as a YAML config file. With redact, secrets
+// and the password in the database DSN are replaced by REDACTED.
+func (cfg *Config) Write(w io.Writer, redact bool) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+
+	for _, s := range cfg.settings() {
+		sectionKey, key, _ := strings.Cut(s.key, ".")
+
+		section, ok := sections[sectionKey]
+		if !ok {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sections[sectionKey] = section
+			root.Content = append(root.Content, scalar(sectionKey, "!!str"), section)
+		}
+
+		value := scalar(s.String(), tagOf(s.value))
+		if redact && s.secret != "" && value.Value != "" {
+			value = scalar(redactSecret(s.secret, value.Value), "!!str")
+		}
+		value.LineComment = s.env
+		section.Content = append(section.Content, scalar(key, "!!str"), value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func scalar(value string, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+func tagOf(value reflect.Value) string {
+	if value.Type() == durationType {
+		return "!!str"
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		return "!!bool"
+	case reflect.Int, reflect.Int64:
+		return "!!int"
+	case reflect.Float64:
+		return "!!float"
+	default:
+		return "!!str"
+	}
+}
+
+// dsnPassword matches the password of a key=value DSN, quoted or not.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func redactSecret(kind string, value string) string {
+	if kind != "dsn" {
+		return redacted
+	}
+
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+
+	return dsnPassword.ReplaceAllString(value, "${1}"+redacted)
+}
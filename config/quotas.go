@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultStorageQuotas gives users 100 MiB and admins unlimited storage.
+const DefaultStorageQuotas = "user=104857600,admin=unlimited"
+
+// Unlimited is the quota ParseQuotas returns for roles without a limit.
+const Unlimited int64 = -1
+
+// ParseQuotas parses a comma separated list of role=bytes entries, where bytes
+// may be "unlimited", into the quota of each role.
+func ParseQuotas(spec string) (map[string]int64, error) {
+	quotas := make(map[string]int64)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		role, raw, ok := strings.Cut(entry, "=")
+		if !ok || role == "" {
+			return nil, fmt.Errorf("invalid quota %q, want role=bytes", entry)
+		}
+
+		if raw == "unlimited" {
+			quotas[role] = Unlimited
+			continue
+		}
+
+		quota, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || quota < 0 {
+			return nil, fmt.Errorf("invalid quota %q for role %s, want bytes or unlimited", raw, role)
+		}
+		quotas[role] = quota
+	}
+
+	return quotas, nil
+}
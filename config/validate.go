@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/aliftoriq/go-crud/password"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ValidationError lists every invalid setting, so they can all be fixed at
+// once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks the settings against each other and against what the
+// service can run with.
+func (cfg *Config) Validate() error {
+	var problems []string
+	problem := func(key string, format string, args ...interface{}) {
+		problems = append(problems, cfg.describe(key)+" "+fmt.Sprintf(format, args...))
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			problem(key, "must be positive")
+		}
+	}
+	notNegative := func(key string, d time.Duration) {
+		if d < 0 {
+			problem(key, "must not be negative")
+		}
+	}
+
+	if cfg.Server.Port == "" {
+		problem("server.port", "is required")
+	}
+	notNegative("server.read_header_timeout", cfg.Server.ReadHeaderTimeout)
+	notNegative("server.read_timeout", cfg.Server.ReadTimeout)
+	notNegative("server.write_timeout", cfg.Server.WriteTimeout)
+	notNegative("server.idle_timeout", cfg.Server.IdleTimeout)
+	positive("server.shutdown_timeout", cfg.Server.ShutdownTimeout)
+	if cfg.Server.ShutdownDelay < 0 || cfg.Server.ShutdownDelay >= cfg.Server.ShutdownTimeout {
+		problem("server.shutdown_delay", "must be between 0 and the shutdown timeout")
+	}
+
+	switch cfg.Log.Format {
+	case "json", "text":
+	default:
+		problem("log.format", "is %q, want json or text", cfg.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		problem("log.level", "is %q, want debug, info, warn or error", cfg.Log.Level)
+	}
+
+	if cfg.Database.DSN == "" {
+		problem("database.dsn", "is required")
+	} else if _, err := pgconn.ParseConfig(cfg.Database.DSN); err != nil {
+		problem("database.dsn", "is not a valid PostgreSQL connection string: %v", err)
+	}
+
+	if cfg.Redis.Addr == "" {
+		problem("redis.addr", "is required")
+	}
+
+	if cfg.Auth.Secret == "" {
+		problem("auth.secret", "is required")
+	}
+
+	if cfg.Passwords.MinLength < 1 || cfg.Passwords.MinLength > password.MaxLength {
+		problem("passwords.min_length", "must be between 1 and %d", password.MaxLength)
+	}
+	if cfg.Passwords.MinEntropy < 0 {
+		problem("passwords.min_entropy", "must not be negative")
+	}
+	if dir := cfg.Passwords.BreachedDir; dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			problem("passwords.breached_dir", "is %q, want a directory", dir)
+		}
+	}
+	switch cfg.Passwords.Hash {
+	case password.Bcrypt:
+		if cfg.Passwords.BcryptCost < bcrypt.MinCost || cfg.Passwords.BcryptCost > bcrypt.MaxCost {
+			problem("passwords.bcrypt_cost", "must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case password.Argon2id:
+		if cfg.Passwords.Argon2Time < 1 {
+			problem("passwords.argon2_time", "must be positive")
+		}
+		if cfg.Passwords.Argon2Memory < 8*cfg.Passwords.Argon2Threads || cfg.Passwords.Argon2Memory > math.MaxUint32 {
+			problem("passwords.argon2_memory", "must be at least 8 KiB per thread")
+		}
+		if cfg.Passwords.Argon2Threads < 1 || cfg.Passwords.Argon2Threads > math.MaxUint8 {
+			problem("passwords.argon2_threads", "must be between 1 and %d", math.MaxUint8)
+		}
+	default:
+		problem("passwords.hash", "is %q, want bcrypt or argon2id", cfg.Passwords.Hash)
+	}
+
+	switch cfg.Storage.Backend {
+	case "minio":
+		if cfg.Minio.Endpoint == "" {
+			problem("minio.endpoint", "is required with the minio storage backend")
+		}
+	case "local":
+		if cfg.Storage.Path == "" {
+			problem("storage.path", "is required with the local storage backend")
+		}
+	case "memory":
+	default:
+		problem("storage.backend", "is %q, want minio, local or memory", cfg.Storage.Backend)
+	}
+	if cfg.Storage.Bucket == "" {
+		problem("storage.bucket", "is required")
+	}
+
+	if cfg.Uploads.MaxSize <= 0 {
+		problem("uploads.max_size", "must be positive")
+	}
+	if cfg.Uploads.MaxResumableSize <= 0 {
+		problem("uploads.max_resumable_size", "must be positive")
+	}
+	if cfg.Uploads.PresignExpiry <= 0 || cfg.Uploads.PresignExpiry > MaxPresignExpiry {
+		problem("uploads.presign_expiry", "must be between 0 and %s", MaxPresignExpiry)
+	}
+	if _, err := images.ParseVariants(cfg.Uploads.ImageVariants); err != nil {
+		problem("uploads.image_variants", "is invalid: %v", err)
+	}
+	if _, err := ParseQuotas(cfg.Uploads.StorageQuotas); err != nil {
+		problem("uploads.storage_quotas", "is invalid: %v", err)
+	}
+
+	switch cfg.Scanner.Backend {
+	case "none", "fake":
+	case "clamav":
+		if cfg.Scanner.ClamAVAddr == "" {
+			problem("scanner.clamav_addr", "is required with the clamav scanner")
+		}
+		positive("scanner.clamav_timeout", cfg.Scanner.ClamAVTimeout)
+	default:
+		problem("scanner.backend", "is %q, want none, clamav or fake", cfg.Scanner.Backend)
+	}
+
+	notNegative("orphans.gc_interval", cfg.Orphans.GCInterval)
+	notNegative("orphans.grace_period", cfg.Orphans.GracePeriod)
+
+	positive("health.postgres_timeout", cfg.Health.PostgresTimeout)
+	positive("health.redis_timeout", cfg.Health.RedisTimeout)
+	positive("health.minio_timeout", cfg.Health.MinioTimeout)
+
+	switch cfg.Tracing.Exporter {
+	case "otlp":
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			problem("tracing.endpoint", "is %q, want a URL like http://localhost:4318", cfg.Tracing.Endpoint)
+		}
+	case "none", "stdout":
+	default:
+		problem("tracing.exporter", "is %q, want none, otlp or stdout", cfg.Tracing.Exporter)
+	}
+	if cfg.Tracing.ServiceName == "" {
+		problem("tracing.service_name", "is required")
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		problem("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// describe names a setting by its file key and environment variable.
+func (cfg *Config) describe(key string) string {
+	for _, s := range cfg.settings() {
+		if s.key == key {
+			return fmt.Sprintf("%s (%s)", s.key, s.env)
+		}
+	}
+	return key
+}
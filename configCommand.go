@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aliftoriq/go-crud/config"
+)
+
+// runConfig implements the config subcommand. It needs no connections, so
+// it also works to find out why the service refuses to start:
+//
+//	go-crud config print [--redact]
+//	go-crud config check
+func runConfig(cfg *config.Config, loadErr error, args []string) {
+	var validationErr *config.ValidationError
+	if loadErr != nil && !errors.As(loadErr, &validationErr) {
+		log.Fatalln(loadErr)
+	}
+
+	if len(args) == 0 {
+		log.Fatalln("usage: config print [--redact] | config check")
+	}
+
+	switch args[0] {
+	case "print":
+		flags := flag.NewFlagSet("config print", flag.ExitOnError)
+		redact := flags.Bool("redact", false, "hide secrets and the database password")
+		flags.Parse(args[1:])
+
+		if err := cfg.Write(os.Stdout, *redact); err != nil {
+			log.Fatalln(err)
+		}
+	case "check":
+	default:
+		log.Fatalf("unknown config command %q, want print or check", args[0])
+	}
+
+	if validationErr != nil {
+		fmt.Fprintln(os.Stderr, validationErr)
+		os.Exit(1)
+	}
+}
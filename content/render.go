@@ -0,0 +1,113 @@
+package content
+
+import (
+	"bytes"
+	"html"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+
+	excerptLength  = 200
+	wordsPerMinute = 200
+)
+
+var (
+	markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	// sanitizer only lets through the elements and attributes expected in
+	// user generated content, so rendered HTML can be embedded safely.
+	sanitizer = bluemonday.UGCPolicy()
+
+	stripTags = bluemonday.StrictPolicy()
+)
+
+// Rendered is the output of Render.
+type Rendered struct {
+	HTML        string
+	Excerpt     string
+	ReadingTime int
+}
+
+// ValidFormat reports whether format is a supported content format. The empty
+// string is accepted and means plain text.
+func ValidFormat(format string) bool {
+	return format == "" || format == FormatPlain || format == FormatMarkdown
+}
+
+// Render converts source in the given format to sanitized HTML and derives a
+// plain text excerpt and an estimated reading time in minutes from it.
+func Render(format string, source string) (Rendered, error) {
+	var unsafeHTML string
+
+	switch format {
+	case FormatMarkdown:
+		var buf bytes.Buffer
+		if err := markdown.Convert([]byte(source), &buf); err != nil {
+			return Rendered{}, err
+		}
+		unsafeHTML = buf.String()
+	default:
+		unsafeHTML = plainToHTML(source)
+	}
+
+	safeHTML := sanitizer.Sanitize(unsafeHTML)
+	text := strings.Join(strings.Fields(html.UnescapeString(stripTags.Sanitize(safeHTML))), " ")
+
+	return Rendered{
+		HTML:        safeHTML,
+		Excerpt:     excerpt(text, excerptLength),
+		ReadingTime: readingTime(text),
+	}, nil
+}
+
+// plainToHTML escapes plain text and keeps its paragraphs and line breaks.
+func plainToHTML(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+
+	var b strings.Builder
+	for _, paragraph := range strings.Split(source, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		lines := strings.Split(html.EscapeString(paragraph), "\n")
+		b.WriteString("<p>")
+		b.WriteString(strings.Join(lines, "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+
+	return b.String()
+}
+
+// excerpt cuts text to at most max characters, on a word boundary if possible.
+func excerpt(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	cut := string([]rune(text)[:max])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
+
+func readingTime(text string) int {
+	words := len(strings.Fields(text))
+	if words == 0 {
+		return 0
+	}
+
+	return int(math.Ceil(float64(words) / wordsPerMinute))
+}
@@ -2,11 +2,16 @@ package controllers
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/aliftoriq/go-crud/content"
+	"github.com/aliftoriq/go-crud/metrics"
 	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
 	"github.com/aliftoriq/go-crud/repositories"
 	"github.com/gin-gonic/gin"
 )
@@ -15,19 +20,35 @@ type ArticlesController interface {
 	CreateArticle(c *gin.Context)
 	GetArticles(c *gin.Context)
 	GetArticleByID(c *gin.Context)
+	GetTrendingArticles(c *gin.Context)
 	UpdateArticle(c *gin.Context)
 	DeleteArticle(c *gin.Context)
 }
 
+// viewDedupWindow is how long repeated views of an article by the same
+// viewer are counted as one.
+const viewDedupWindow = 30 * time.Minute
+
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  repositories.TrendingMaxWindow,
+}
+
 type articlesController struct {
-	arRepo    repositories.ArticleRepository
-	cacheRepo repositories.CacheRepository
+	arRepo      repositories.ArticleRepository
+	cacheRepo   repositories.CacheRepository
+	counterRepo repositories.CounterRepository
+	viewRepo    repositories.ViewRepository
 }
 
-func NewArticlesController(arRepo repositories.ArticleRepository, cacheRepo repositories.CacheRepository) ArticlesController {
+func NewArticlesController(arRepo repositories.ArticleRepository, cacheRepo repositories.CacheRepository, counterRepo repositories.CounterRepository, viewRepo repositories.ViewRepository) ArticlesController {
 	return &articlesController{
-		arRepo:    arRepo,
-		cacheRepo: cacheRepo,
+		arRepo:      arRepo,
+		cacheRepo:   cacheRepo,
+		counterRepo: counterRepo,
+		viewRepo:    viewRepo,
 	}
 }
 
@@ -40,34 +61,40 @@ func NewArticlesController(arRepo repositories.ArticleRepository, cacheRepo repo
 // @Param Authorization header string true "User Token"
 // @Param body body Article true "Article creation details"
 // @Success 200 {object} Response
-// @Failure 400 {object} ResponseErr
-// @Failure 500 {object} ResponseErr
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /articles [post]
 func (h *articlesController) CreateArticle(c *gin.Context) {
-	var body struct {
-		Email   string `json:"email"`
-		Title   string `json:"title"`
-		Content string `json:"content"`
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
 	}
 
-	if c.Bind(&body) != nil {
-		c.JSON(http.StatusBadRequest, ResponseErr{
-			Error: "FAILED TO READ BODY",
-		})
+	var body Article
+
+	if err := c.ShouldBind(&body); err != nil {
+		c.Error(bindError(err))
 		return
 	}
 
 	article := models.Article{
-		Email:   body.Email,
-		Title:   body.Title,
-		Content: body.Content,
+		UserID:        user.ID,
+		Email:         user.Email,
+		Title:         body.Title,
+		Content:       body.Content,
+		ContentFormat: body.ContentFormat,
+	}
+
+	if err := renderContent(&article); err != nil {
+		c.Error(err)
+		return
 	}
 
 	arRepo := h.arRepo
-	if err := arRepo.CreateArticle(article); err != nil {
-		c.JSON(http.StatusBadRequest, ResponseErr{
-			Error: "Failed to create Article",
-		})
+	if err := arRepo.CreateArticle(c, article); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -84,7 +111,7 @@ func (h *articlesController) CreateArticle(c *gin.Context) {
 // @Produce json
 // @Param Authorization header string true "User Token"
 // @Success 200 {object} GetArticlesResponseswag
-// @Failure 500 {object} ResponseErr
+// @Failure 500 {object} problem.Problem
 // @Router /articles [get]
 func (h *articlesController) GetArticles(c *gin.Context) {
 	key := "all_article"
@@ -92,13 +119,20 @@ func (h *articlesController) GetArticles(c *gin.Context) {
 	// Get data from cache redis
 	art, status, err := h.cacheRepo.GetValueByKey(c, key)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to get articles from cache", err)
+		c.Error(err)
 		return
-	} else if status {
+	}
+	metrics.CacheLookup("articles", status)
+	if status {
 		var cachedArticles []models.Article
 		err := json.Unmarshal([]byte(art), &cachedArticles)
 		if err != nil {
-			handleError(c, http.StatusInternalServerError, "Failed to unmarshal cached data", err)
+			c.Error(err)
+			return
+		}
+
+		if err := applyCounters(c, h.counterRepo, cachedArticles); err != nil {
+			c.Error(err)
 			return
 		}
 
@@ -111,22 +145,27 @@ func (h *articlesController) GetArticles(c *gin.Context) {
 
 	// Cache miss, fetch data from the database
 	arRepo := h.arRepo
-	result, err := arRepo.GetArticles()
+	result, err := arRepo.GetArticles(c)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to get Articles", err)
+		c.Error(err)
 		return
 	}
 
 	// Cache the fetched data
 	data, err := json.Marshal(result)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to marshal data for cache", err)
+		c.Error(err)
 		return
 	}
 
 	errSetCache := h.cacheRepo.SetKey(c, key, data, time.Second*60)
 	if errSetCache != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to set cache", errSetCache)
+		c.Error(errSetCache)
+		return
+	}
+
+	if err := applyCounters(c, h.counterRepo, *result); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -145,8 +184,8 @@ func (h *articlesController) GetArticles(c *gin.Context) {
 // @Param id path string true "Article ID"
 // @Param Authorization header string true "User Token"
 // @Success 200 {object} GetArticleByIDResponseSwag
-// @Failure 404 {object} ResponseErr
-// @Failure 500 {object} ResponseErr
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /articles/{id} [get]
 func (h *articlesController) GetArticleByID(c *gin.Context) {
 	id := c.Param("id")
@@ -154,12 +193,21 @@ func (h *articlesController) GetArticleByID(c *gin.Context) {
 
 	art, status, err := h.cacheRepo.GetValueByKey(c, cacheKey)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to get article from cache", err)
+		c.Error(err)
 		return
-	} else if status {
+	}
+	metrics.CacheLookup("article", status)
+	if status {
 		var cachedArticle models.Article
 		if err := json.Unmarshal([]byte(art), &cachedArticle); err != nil {
-			handleError(c, http.StatusInternalServerError, "Failed to unmarshal cached article data", err)
+			c.Error(err)
+			return
+		}
+
+		h.recordView(c, cachedArticle.ID)
+
+		if err := h.applyArticleCounters(c, &cachedArticle); err != nil {
+			c.Error(err)
 			return
 		}
 
@@ -171,21 +219,28 @@ func (h *articlesController) GetArticleByID(c *gin.Context) {
 	}
 
 	arRepo := h.arRepo
-	result, err := arRepo.GetArticleById(id)
+	result, err := arRepo.GetArticleById(c, id)
 	if err != nil {
-		handleError(c, http.StatusNotFound, "Article not found", err)
+		c.Error(err)
 		return
 	}
 
+	h.recordView(c, result.ID)
+
 	// Set Cache to Redis
 	data, err := json.Marshal(result)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to marshal article data for cache", err)
+		c.Error(err)
 		return
 	}
 
 	if err := h.cacheRepo.SetKey(c, cacheKey, data, time.Second*60); err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to set article cache", err)
+		c.Error(err)
+		return
+	}
+
+	if err := h.applyArticleCounters(c, result); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -195,6 +250,72 @@ func (h *articlesController) GetArticleByID(c *gin.Context) {
 	})
 }
 
+// GetTrendingArticles godoc
+// @Summary Get trending articles
+// @Description Get the most viewed articles of a time window, with recent views weighted more than older ones
+// @Tags articles
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param window query string false "Time window" Enums(1h, 6h, 24h, 7d) default(24h)
+// @Param limit query int false "Number of articles"
+// @Success 200 {object} GetTrendingArticlesResponseSwag
+// @Failure 400 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/trending [get]
+func (h *articlesController) GetTrendingArticles(c *gin.Context) {
+	windowName := c.DefaultQuery("window", "24h")
+	window, ok := trendingWindows[windowName]
+	if !ok {
+		c.Error(errInvalidWindow)
+		return
+	}
+
+	_, limit := parsePagination(c)
+
+	ranked, err := h.viewRepo.GetTrending(c, window, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ids := make([]int, len(ranked))
+	for i, entry := range ranked {
+		ids[i] = entry.ArticleID
+	}
+
+	articles, err := h.arRepo.GetArticlesByIDs(c, ids)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := applyCounters(c, h.counterRepo, *articles); err != nil {
+		c.Error(err)
+		return
+	}
+
+	scores := make(map[int]float64, len(ranked))
+	for _, entry := range ranked {
+		scores[entry.ArticleID] = entry.Score
+	}
+
+	trending := make([]TrendingArticle, len(*articles))
+	for i := range *articles {
+		article := &(*articles)[i]
+		trending[i] = TrendingArticle{
+			Score:   scores[article.ID],
+			Article: article,
+		}
+	}
+
+	c.JSON(http.StatusOK, GetTrendingArticlesResponse{
+		Message: "Get Trending Articles Successfully",
+		Window:  windowName,
+		Data:    trending,
+	})
+}
+
 // UpdateArticle godoc
 // @Summary Update article
 // @Description Update article with title and content by ID
@@ -205,34 +326,47 @@ func (h *articlesController) GetArticleByID(c *gin.Context) {
 // @Param id path string true "Article ID"
 // @Param body body Article true "Article creation details"
 // @Success 200 {object} Response
-// @Failure 400 {object} ResponseErr
-// @Failure 500 {object} ResponseErr
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /articles/{id} [PUT]
 func (h *articlesController) UpdateArticle(c *gin.Context) {
 	arRepo := h.arRepo
 	id := c.Param("id")
 
-	var updatedArticle models.Article
+	var updatedArticle Article
 	if err := c.ShouldBindJSON(&updatedArticle); err != nil {
-		err := ResponseErr{
-			Error: "Invalid request data",
-		}
-		c.JSON(http.StatusBadRequest, err)
+		c.Error(bindError(err))
 		return
 	}
 
 	var existingArticle models.Article
 	existingArticle.Title = updatedArticle.Title
 	existingArticle.Content = updatedArticle.Content
+	existingArticle.ContentFormat = updatedArticle.ContentFormat
 
-	if err := arRepo.UpdateArticle(id, existingArticle); err != nil {
-		err := ResponseErr{
-			Error: err.Error(),
+	// Keep the format of the stored content when the update leaves it out
+	if existingArticle.ContentFormat == "" {
+		stored, err := arRepo.GetArticleById(c, id)
+		if err != nil {
+			c.Error(err)
+			return
 		}
-		c.JSON(http.StatusInternalServerError, err)
+		existingArticle.ContentFormat = stored.ContentFormat
+	}
+
+	if err := renderContent(&existingArticle); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := arRepo.UpdateArticle(c, id, existingArticle); err != nil {
+		c.Error(err)
 		return
 	}
 
+	h.invalidateArticleCache(c, id)
+
 	resp := Response{
 		Message: "Article updated successfully",
 	}
@@ -248,19 +382,16 @@ func (h *articlesController) UpdateArticle(c *gin.Context) {
 // @Param id path string true "Article ID"
 // @Param Authorization header string true "User Token"
 // @Success 200 {object} Response
-// @Failure 404 {object} ResponseErr
-// @Failure 500 {object} ResponseErr
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /articles/{id} [delete]
 func (h *articlesController) DeleteArticle(c *gin.Context) {
 	id := c.Param("id")
 
 	arRepo := h.arRepo
 
-	if err := arRepo.DeleteArticle(id); err != nil {
-		err := ResponseErr{
-			Error: err.Error(),
-		}
-		c.JSON(http.StatusNotFound, err)
+	if err := arRepo.DeleteArticle(c, id); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -270,10 +401,67 @@ func (h *articlesController) DeleteArticle(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-func handleError(c *gin.Context, statusCode int, message string, err error) {
-	log.Println(message, err)
-	c.JSON(statusCode, gin.H{
-		"error":   message,
-		"details": err.Error(),
-	})
+// invalidateArticleCache drops the cached article responses so readers get
+// the updated content.
+func (h *articlesController) invalidateArticleCache(c *gin.Context, id string) {
+	if err := h.cacheRepo.DeleteKey(c, "all_article", "article_"+id); err != nil {
+		slog.ErrorContext(c, "failed to invalidate article cache", "error", err)
+	}
+}
+
+// recordView counts a view of the article by the logged in user, or by the
+// client IP when there is no user. Failures are logged and do not fail the read.
+// Articles that were not found are cached too, with ID 0; they get no views.
+func (h *articlesController) recordView(c *gin.Context, articleID int) {
+	if articleID == 0 {
+		return
+	}
+
+	viewer := "ip:" + c.ClientIP()
+	if user, ok := currentUser(c); ok {
+		viewer = "user:" + strconv.Itoa(user.ID)
+	}
+
+	counted, err := h.viewRepo.RecordView(c, articleID, viewer, viewDedupWindow)
+	if err != nil {
+		slog.ErrorContext(c, "failed to record article view", "error", err)
+	}
+	if !counted {
+		return
+	}
+
+	if err := h.counterRepo.Incr(c, articleID, viewsCounter, 1); err != nil {
+		slog.ErrorContext(c, "failed to update view count", "error", err)
+	}
+}
+
+func (h *articlesController) applyArticleCounters(c *gin.Context, article *models.Article) error {
+	articles := []models.Article{*article}
+	if err := applyCounters(c, h.counterRepo, articles); err != nil {
+		return err
+	}
+
+	*article = articles[0]
+	return nil
+}
+
+// renderContent validates the content format of the article and stores the
+// rendered HTML, excerpt and reading time on it, so reads never render.
+func renderContent(article *models.Article) error {
+	if !content.ValidFormat(article.ContentFormat) {
+		return errInvalidFormat
+	}
+	if article.ContentFormat == "" {
+		article.ContentFormat = content.FormatPlain
+	}
+
+	rendered, err := content.Render(article.ContentFormat, article.Content)
+	if err != nil {
+		return fmt.Errorf("failed to render content: %w", err)
+	}
+
+	article.ContentHTML = rendered.HTML
+	article.Excerpt = rendered.Excerpt
+	article.ReadingTime = rendered.ReadingTime
+	return nil
 }
@@ -1,12 +1,21 @@
 package controllers
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
+	"github.com/aliftoriq/go-crud/config"
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
 	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -15,94 +24,576 @@ type BucketControllers interface {
 	UploadImageToMinio(c *gin.Context)
 	GetImage(c *gin.Context)
 	DeleteImage(c *gin.Context)
+	PresignUpload(c *gin.Context)
+	CompleteUpload(c *gin.Context)
+	PresignImage(c *gin.Context)
+	CreateMultipartUpload(c *gin.Context)
+	UploadPart(c *gin.Context)
+	GetMultipartUpload(c *gin.Context)
+	CompleteMultipartUpload(c *gin.Context)
+	AbortMultipartUpload(c *gin.Context)
 }
 
 type bucketControllers struct {
 	bucketRepository repositories.BucketRepository
+	mediaRepository  repositories.MediaRepository
+	cacheRepository  repositories.CacheRepository
+	variants         map[string]images.Variant
+	scanner          scanner.Scanner
+	bucketName       string
+	uploads          config.Uploads
+	quotas           map[string]int64
 }
 
-func NewBucketControllers(buckerRepo repositories.BucketRepository) BucketControllers {
-	return &bucketControllers{bucketRepository: buckerRepo}
+// pendingUpload is what PresignUpload remembers until the upload is completed.
+type pendingUpload struct {
+	UserID      int    `json:"user_id"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+func NewBucketControllers(buckerRepo repositories.BucketRepository, mediaRepo repositories.MediaRepository, cacheRepo repositories.CacheRepository, variants map[string]images.Variant, uploadScanner scanner.Scanner, bucketName string, uploads config.Uploads, quotas map[string]int64) BucketControllers {
+	return &bucketControllers{bucketRepository: buckerRepo, mediaRepository: mediaRepo, cacheRepository: cacheRepo, variants: variants, scanner: uploadScanner, bucketName: bucketName, uploads: uploads, quotas: quotas}
 }
 
 func (bc *bucketControllers) UploadImageToMinio(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	// Reject oversized bodies while reading them instead of after buffering
+	// the whole upload. The slack leaves room for the multipart framing.
+	maxSize := bc.uploads.MaxSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+(1<<20))
 
 	file, err := c.FormFile("image")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.Error(errImageTooLarge)
+			return
+		}
+		c.Error(problem.ErrInvalidBody)
 		return
 	}
 
-	bucketName := os.Getenv("BUCKETNAME")
+	if file.Size > maxSize {
+		c.Error(errImageTooLarge)
+		return
+	}
 
-	newUUID := uuid.NewString()
-	objectName := newUUID + ".jpg"
+	if !bc.checkQuota(c, user, file.Size) {
+		return
+	}
 
-	// untuk testing
-	// objectName := "test.jpg"
+	bucketName := bc.bucketName
 
 	fileContent, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	defer fileContent.Close()
 
-	// _, err = minioClient.bucket.PutObject(context.Background(), bucketName, objectName, fileContent, file.Size, minio.PutObjectOptions{ContentType: "img/png"})
+	contentType, ext, err := sniffImage(fileContent)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-	err = bc.bucketRepository.PutObject(c, bucketName, objectName, fileContent, file.Size)
+	data, err := io.ReadAll(fileContent)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Image uploaded successfully",
-		"fileName": objectName,
+	data, meta, err := prepareImage(c, data, bc.uploads.StripMetadata)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	newUUID := uuid.NewString()
+	objectName := newUUID + ext
+
+	// untuk testing
+	// objectName := "test.jpg"
+
+	err = bc.bucketRepository.PutObject(c, bucketName, scanner.QuarantineObject(objectName), bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	bc.admitUpload(c, bucketName, user, &models.Media{
+		ObjectName:  objectName,
+		UserID:      user.ID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       meta.Width,
+		Height:      meta.Height,
+		Format:      meta.Format,
 	})
 }
 
+// GetImage streams an image or one of its variants. Range requests are
+// answered with 206 and a matching If-None-Match with 304, both driven by the
+// object's ETag. Images whose media has not passed the scan are not found.
 func (bc *bucketControllers) GetImage(c *gin.Context) {
 	objectName := c.Param("id")
-	bucketName := os.Getenv("BUCKETNAME")
+	bucketName := bc.bucketName
 
-	// image, err := minioClient.bucket.GetObject(c, bucketName, objectName, minio.GetObjectOptions{})
+	if !bc.checkServable(c, objectName) {
+		return
+	}
+
+	if c.Query("variant") != "" || c.Query("w") != "" || c.Query("h") != "" {
+		variantName, ok := bc.variantObject(c, bucketName, objectName)
+		if !ok {
+			return
+		}
+		objectName = variantName
+	}
+
+	info, ok := bc.statImage(c, bucketName, objectName)
+	if !ok {
+		return
+	}
 
 	image, err := bc.bucketRepository.GetObject(c, bucketName, objectName)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer image.Close()
+
+	// Headers must be set before the body is written. With Content-Type set,
+	// ServeContent does not sniff the content itself.
+	c.Header("Content-Type", info.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	// Object names are never reused, so the content behind a URL never changes
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Header("ETag", `"`+info.ETag+`"`)
+
+	// ServeContent sets Content-Length and handles Range, If-Range and
+	// If-None-Match against the ETag set above.
+	http.ServeContent(c.Writer, c.Request, objectName, info.LastModified, image)
+}
+
+// DeleteImage deletes an image with its variants. Only the user who uploaded
+// it or an admin can delete it.
+func (bc *bucketControllers) DeleteImage(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	bucketName := bc.bucketName
+	objectName := c.Param("id")
+
+	// Objects without media were uploaded before ownership was recorded, so
+	// only admins can delete them.
+	media, err := bc.mediaRepository.GetMediaByObjectName(c, objectName)
+	if err != nil && !(errors.Is(err, repositories.ErrMediaNotFound) && user.Role == models.RoleAdmin) {
+		c.Error(err)
+		return
+	}
+	if media != nil && media.UserID != user.ID && user.Role != models.RoleAdmin {
+		c.Error(errNotImageOwner)
+		return
+	}
 
+	err = deleteImageObjects(c, bc.bucketRepository, bucketName, objectName)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Connection Refused / File Name Not Found",
-			"error":   err.Error()})
-		fmt.Println(err)
+		c.Error(err)
+		return
+	}
+
+	if media != nil {
+		if err := bc.mediaRepository.DeleteMedia(c, media); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Image deleted successfully",
+	})
+}
+
+// PresignUpload hands out a URL the client uploads the image to directly,
+// without the bytes passing through this server. The upload only becomes
+// media once CompleteUpload has verified it.
+func (bc *bucketControllers) PresignUpload(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	var body PresignUploadRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	ext, ok := imageTypes[body.ContentType]
+	if !ok {
+		c.Error(errUnsupportedType)
+		return
+	}
+
+	if body.Size <= 0 || body.Size > bc.uploads.MaxSize {
+		c.Error(errImageTooLarge)
+		return
+	}
+
+	if !bc.checkQuota(c, user, body.Size) {
+		return
 	}
 
-	// defer image.Close()
+	bucketName := bc.bucketName
+	objectName := uuid.NewString() + ext
+	expiry := bc.uploads.PresignExpiry
 
-	_, err = io.Copy(c.Writer, image)
+	url, err := bc.bucketRepository.PresignPutObject(c, bucketName, scanner.QuarantineObject(objectName), expiry, body.ContentType, body.Size)
 	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Image Not Found"})
+		c.Error(err)
 		return
 	}
 
-	c.Header("Content-Type", "image/jpeg")
+	pending, err := json.Marshal(pendingUpload{
+		UserID:      user.ID,
+		ContentType: body.ContentType,
+		Size:        body.Size,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := bc.cacheRepository.SetKey(c, pendingUploadKey(objectName), pending, expiry+pendingUploadGrace); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Upload URL created successfully",
+		"fileName":  objectName,
+		"method":    http.MethodPut,
+		"url":       url,
+		"expiresAt": time.Now().Add(expiry),
+		"headers": gin.H{
+			"Content-Type":   body.ContentType,
+			"Content-Length": strconv.FormatInt(body.Size, 10),
+		},
+	})
 }
 
-func (bc *bucketControllers) DeleteImage(c *gin.Context) {
-	bucketName := os.Getenv("BUCKETNAME")
+// CompleteUpload registers an object uploaded through a presigned URL after
+// checking that its size and real content type match what was presigned.
+// Objects that do not match are deleted.
+func (bc *bucketControllers) CompleteUpload(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	var body CompleteUploadRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	key := pendingUploadKey(body.FileName)
+	value, exists, err := bc.cacheRepository.GetValueByKey(c, key)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var pending pendingUpload
+	if !exists || json.Unmarshal([]byte(value), &pending) != nil {
+		c.Error(repositories.ErrUploadNotFound)
+		return
+	}
+
+	if pending.UserID != user.ID {
+		c.Error(errNotUploadOwner)
+		return
+	}
+
+	bucketName := bc.bucketName
+
+	quarantined := scanner.QuarantineObject(body.FileName)
+
+	info, err := bc.bucketRepository.StatObject(c, bucketName, quarantined)
+	if errors.Is(err, repositories.ErrObjectNotFound) {
+		c.Error(errImageNotUploaded)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if info.Size != pending.Size {
+		bc.rejectUpload(c, bucketName, body.FileName, errSizeMismatch)
+		return
+	}
+
+	contentType, err := sniffObject(c, bc.bucketRepository, bucketName, quarantined)
+	if err != nil && err != errUnsupportedType {
+		c.Error(err)
+		return
+	}
+	if err != nil || contentType != pending.ContentType {
+		bc.rejectUpload(c, bucketName, body.FileName, errTypeMismatch)
+		return
+	}
+
+	// Other uploads may have completed since the URL was presigned
+	if !bc.checkQuota(c, user, info.Size) {
+		bc.discardUpload(c, bucketName, body.FileName)
+		return
+	}
+
+	meta, size, err := prepareStoredImage(c, bc.bucketRepository, bucketName, quarantined, contentType, bc.uploads.StripMetadata)
+	if err == errUnreadableImage {
+		bc.rejectUpload(c, bucketName, body.FileName, err)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := bc.cacheRepository.DeleteKey(c, key); err != nil {
+		slog.ErrorContext(c, "failed to delete pending upload", "object", body.FileName, "error", err)
+	}
+
+	bc.admitUpload(c, bucketName, user, &models.Media{
+		ObjectName:  body.FileName,
+		UserID:      user.ID,
+		ContentType: contentType,
+		Size:        size,
+		Width:       meta.Width,
+		Height:      meta.Height,
+		Format:      meta.Format,
+	})
+}
+
+// PresignImage hands out a URL that downloads the image directly from the
+// bucket. The expiry query parameter, e.g. "1h", overrides PRESIGN_EXPIRY.
+func (bc *bucketControllers) PresignImage(c *gin.Context) {
 	objectName := c.Param("id")
+	bucketName := bc.bucketName
+
+	expiry := bc.uploads.PresignExpiry
+	if raw := c.Query("expiry"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 || parsed > config.MaxPresignExpiry {
+			c.Error(errInvalidExpiry)
+			return
+		}
+		expiry = parsed
+	}
 
-	// err := minioClient.bucket.RemoveObject(c, bucketName, objectName, minio.RemoveObjectOptions{})
-	err := bc.bucketRepository.DeleteObject(c, bucketName, objectName)
+	if !bc.checkServable(c, objectName) {
+		return
+	}
+	if _, ok := bc.statImage(c, bucketName, objectName); !ok {
+		return
+	}
+
+	url, err := bc.bucketRepository.PresignGetObject(c, bucketName, objectName, expiry)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Image deleted successfully",
+		"message":   "Download URL created successfully",
+		"url":       url,
+		"expiresAt": time.Now().Add(expiry),
 	})
 }
+
+func (bc *bucketControllers) rejectUpload(c *gin.Context, bucketName string, objectName string, err error) {
+	bc.discardUpload(c, bucketName, objectName)
+	c.Error(err)
+}
+
+// discardUpload deletes a quarantined upload that will not become media.
+func (bc *bucketControllers) discardUpload(c *gin.Context, bucketName string, objectName string) {
+	if err := bc.bucketRepository.DeleteObject(c, bucketName, scanner.QuarantineObject(objectName)); err != nil {
+		slog.ErrorContext(c, "failed to delete quarantined upload", "object", objectName, "error", err)
+	}
+	if err := bc.cacheRepository.DeleteKey(c, pendingUploadKey(objectName)); err != nil {
+		slog.ErrorContext(c, "failed to delete pending upload", "object", objectName, "error", err)
+	}
+}
+
+// checkServable checks that the media of an image has passed the scan, so
+// an upload is never served before it is clean, even when it was moved out
+// of quarantine but its status could not be saved. Images uploaded before
+// media were recorded get media from jobs.RegisterLegacyObjects, so objects
+// without media are orphans, which only admins get. It reports the error
+// itself, as a missing image.
+func (bc *bucketControllers) checkServable(c *gin.Context, objectName string) bool {
+	media, err := bc.mediaRepository.GetMediaByObjectName(c, objectName)
+	if errors.Is(err, repositories.ErrMediaNotFound) {
+		if user, _ := currentUser(c); user.Role == models.RoleAdmin {
+			return true
+		}
+		c.Error(repositories.ErrObjectNotFound)
+		return false
+	}
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	if media.Status != models.MediaStatusClean {
+		c.Error(repositories.ErrObjectNotFound)
+		return false
+	}
+	return true
+}
+
+// statImage stats an object, answering 404 when it does not exist. It reports
+// the error itself.
+func (bc *bucketControllers) statImage(c *gin.Context, bucketName string, objectName string) (repositories.ObjectInfo, bool) {
+	info, err := bc.bucketRepository.StatObject(c, bucketName, objectName)
+	if err != nil {
+		c.Error(err)
+		return info, false
+	}
+	return info, true
+}
+
+// admitUpload records a quarantined upload of the user as pending media and
+// scans it. Clean uploads become available right away and infected ones are
+// deleted. If the scan fails the media stays pending and is scanned again
+// later by the ScanPendingMedia job. It writes the response itself.
+func (bc *bucketControllers) admitUpload(c *gin.Context, bucketName string, user models.User, media *models.Media) {
+	media.Status = models.MediaStatusPending
+	if !bc.createMedia(c, user, media) {
+		// Do not leave an object behind that nothing refers to
+		bc.discardUpload(c, bucketName, media.ObjectName)
+		return
+	}
+
+	result, err := scanner.Admit(c, bc.scanner, bc.bucketRepository, bucketName, media.ObjectName)
+	if err != nil {
+		slog.ErrorContext(c, "failed to scan upload", "object", media.ObjectName, "error", err)
+		c.JSON(http.StatusAccepted, uploadResponse(media))
+		return
+	}
+
+	if !result.Clean {
+		slog.WarnContext(c, "upload is infected", "object", media.ObjectName, "user_id", media.UserID, "threat", result.Threat)
+		if err := bc.mediaRepository.DeleteMedia(c, media); err != nil {
+			slog.ErrorContext(c, "failed to delete infected media", "object", media.ObjectName, "error", err)
+		}
+		c.Error(errImageInfected.With("threat", result.Threat))
+		return
+	}
+
+	if err := bc.mediaRepository.SetStatus(c, media, models.MediaStatusClean); err != nil {
+		c.Error(err)
+		return
+	}
+	media.Status = models.MediaStatusClean
+
+	c.JSON(http.StatusOK, uploadResponse(media))
+}
+
+// uploadResponse is the response to every kind of completed upload.
+func uploadResponse(media *models.Media) gin.H {
+	return gin.H{
+		"message":     "Image uploaded successfully",
+		"fileName":    media.ObjectName,
+		"mediaId":     media.ID,
+		"contentType": media.ContentType,
+		"size":        media.Size,
+		"width":       media.Width,
+		"height":      media.Height,
+		"format":      media.Format,
+		"status":      media.Status,
+	}
+}
+
+// pendingUploadGrace is how long a presigned upload can still be completed
+// after its URL expired, since an upload started just before the expiry
+// finishes after it.
+const pendingUploadGrace = time.Hour
+
+func pendingUploadKey(objectName string) string {
+	return "upload_pending_" + objectName
+}
+
+// variantObject returns the name of the variant of objectName requested by the
+// query string, generating and storing the variant on first request. Sizes
+// requested with w and h are snapped to images.AdHocSizes, which bounds the
+// variants stored per image. It reports the error itself.
+func (bc *bucketControllers) variantObject(c *gin.Context, bucketName string, objectName string) (string, bool) {
+	var variant images.Variant
+	if name := c.Query("variant"); name != "" {
+		v, ok := bc.variants[name]
+		if !ok {
+			c.Error(errUnknownVariant)
+			return "", false
+		}
+		variant = v
+	} else {
+		v, err := images.NewVariant(c.Query("w"), c.Query("h"), c.Query("fit"))
+		if err != nil {
+			c.Error(problem.New(http.StatusBadRequest, "invalid_variant", err.Error()))
+			return "", false
+		}
+		variant = v.Snap()
+	}
+
+	original, ok := bc.statImage(c, bucketName, objectName)
+	if !ok {
+		return "", false
+	}
+
+	outputType, ext := images.OutputType(original.ContentType)
+	variantName := variant.ObjectName(objectName, ext)
+
+	if _, err := bc.bucketRepository.StatObject(c, bucketName, variantName); err == nil {
+		return variantName, true
+	}
+
+	source, err := bc.bucketRepository.GetObject(c, bucketName, objectName)
+	if err != nil {
+		c.Error(err)
+		return "", false
+	}
+	defer source.Close()
+
+	data, err := images.Resize(source, variant, outputType)
+	if err != nil {
+		slog.WarnContext(c, "failed to resize image", "object", objectName, "variant", variant.Name, "error", err)
+		c.Error(errResizeFailed)
+		return "", false
+	}
+
+	err = bc.bucketRepository.PutObject(c, bucketName, variantName, bytes.NewReader(data), int64(len(data)), outputType)
+	if err != nil {
+		c.Error(err)
+		return "", false
+	}
+
+	if err := bc.mediaRepository.AddVariantSize(c, objectName, int64(len(data))); err != nil {
+		slog.ErrorContext(c, "failed to count variant toward storage", "object", variantName, "error", err)
+	}
+
+	return variantName, true
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliftoriq/go-crud/config"
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+	"github.com/gin-gonic/gin"
+)
+
+const testBucket = "images"
+
+// eicar is the antivirus test signature, which scanner.Fake finds.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeMediaRepository keeps media in memory. Methods the tests do not need
+// are left to the nil MediaRepository and panic.
+type fakeMediaRepository struct {
+	repositories.MediaRepository
+
+	media  map[string]*models.Media
+	nextID uint
+	// created are the object names of all media ever created.
+	created []string
+	// setStatusErr makes SetStatus fail.
+	setStatusErr error
+}
+
+func newFakeMediaRepository() *fakeMediaRepository {
+	return &fakeMediaRepository{media: make(map[string]*models.Media)}
+}
+
+func (r *fakeMediaRepository) CreateMedia(ctx context.Context, media *models.Media) error {
+	r.nextID++
+	media.ID = r.nextID
+	r.created = append(r.created, media.ObjectName)
+	stored := *media
+	r.media[media.ObjectName] = &stored
+	return nil
+}
+
+func (r *fakeMediaRepository) GetMediaByObjectName(ctx context.Context, objectName string) (*models.Media, error) {
+	media, ok := r.media[objectName]
+	if !ok {
+		return nil, repositories.ErrMediaNotFound
+	}
+	found := *media
+	return &found, nil
+}
+
+func (r *fakeMediaRepository) DeleteMedia(ctx context.Context, media *models.Media) error {
+	delete(r.media, media.ObjectName)
+	return nil
+}
+
+func (r *fakeMediaRepository) SetStatus(ctx context.Context, media *models.Media, status string) error {
+	if r.setStatusErr != nil {
+		return r.setStatusErr
+	}
+	r.media[media.ObjectName].Status = status
+	return nil
+}
+
+type imageTest struct {
+	router     *gin.Engine
+	bucketRepo repositories.BucketRepository
+	mediaRepo  *fakeMediaRepository
+}
+
+// newImageTest serves the image routes for a logged in user with the role.
+func newImageTest(uploadScanner scanner.Scanner, role string) *imageTest {
+	gin.SetMode(gin.TestMode)
+
+	it := &imageTest{
+		bucketRepo: repositories.NewMemoryBucketRepository(),
+		mediaRepo:  newFakeMediaRepository(),
+	}
+	uploads := config.Default().Uploads
+	bc := NewBucketControllers(it.bucketRepo, it.mediaRepo, nil, nil, uploadScanner, testBucket, uploads, nil)
+
+	it.router = gin.New()
+	it.router.Use(problem.Middleware())
+	it.router.Use(func(c *gin.Context) {
+		c.Set("user", models.User{ID: 1, Role: role})
+	})
+	it.router.POST("/upload-image", bc.UploadImageToMinio)
+	it.router.GET("/image/:id", bc.GetImage)
+	return it
+}
+
+func (it *imageTest) do(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	it.router.ServeHTTP(w, req)
+	return w
+}
+
+func (it *imageTest) upload(t *testing.T, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-image", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return it.do(req)
+}
+
+func (it *imageTest) get(objectName string) *httptest.ResponseRecorder {
+	return it.do(httptest.NewRequest(http.MethodGet, "/image/"+objectName, nil))
+}
+
+// uploadedName returns the object name of the only media created.
+func (it *imageTest) uploadedName(t *testing.T) string {
+	t.Helper()
+	if len(it.mediaRepo.created) != 1 {
+		t.Fatalf("%d media were created, want 1", len(it.mediaRepo.created))
+	}
+	return it.mediaRepo.created[0]
+}
+
+// testPNG returns a PNG with payload in a private chunk, which survives
+// metadata stripping.
+func testPNG(t *testing.T, payload string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(append(chunk, "ruSt"...), payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// The signature and the 25 byte header chunk come first
+	out := append([]byte(nil), encoded[:33]...)
+	out = append(out, chunk...)
+	return append(out, encoded[33:]...)
+}
+
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	var p struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if w.Code != status || p.Code != code {
+		t.Fatalf("response = %d %s, want %d %s", w.Code, w.Body, status, code)
+	}
+}
+
+func TestUploadInfectedImageIsDeletedAndNeverServed(t *testing.T) {
+	it := newImageTest(scanner.Fake{}, models.RoleUser)
+
+	assertProblem(t, it.upload(t, testPNG(t, eicar)), http.StatusUnprocessableEntity, "image_infected")
+
+	if len(it.mediaRepo.media) != 0 {
+		t.Errorf("media of the infected upload was kept")
+	}
+	objects, err := it.bucketRepo.ListObjects(context.Background(), testBucket, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("objects %v were kept, want none", objects)
+	}
+
+	assertProblem(t, it.get(it.uploadedName(t)), http.StatusNotFound, "image_not_found")
+}
+
+func TestUploadCleanImageIsServed(t *testing.T) {
+	it := newImageTest(scanner.Fake{}, models.RoleUser)
+
+	data := testPNG(t, "clean")
+	if w := it.upload(t, data); w.Code != http.StatusOK {
+		t.Fatalf("upload = %d %s, want 200", w.Code, w.Body)
+	}
+
+	w := it.get(it.uploadedName(t))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetImage = %d %s, want 200", w.Code, w.Body)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Error("GetImage served other content than was uploaded")
+	}
+}
+
+func TestImageIsNotServedUntilItIsMarkedClean(t *testing.T) {
+	it := newImageTest(scanner.Fake{}, models.RoleUser)
+	it.mediaRepo.setStatusErr = errors.New("FAILED TO UPDATE MEDIA")
+
+	assertProblem(t, it.upload(t, testPNG(t, "clean")), http.StatusInternalServerError, "internal_error")
+
+	// The scan passed, so the object was moved out of quarantine, but its
+	// media is still pending
+	objectName := it.uploadedName(t)
+	if _, err := it.bucketRepo.StatObject(context.Background(), testBucket, objectName); err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	assertProblem(t, it.get(objectName), http.StatusNotFound, "image_not_found")
+}
+
+func TestImageWithoutMediaIsOnlyServedToAdmins(t *testing.T) {
+	for role, status := range map[string]int{models.RoleUser: http.StatusNotFound, models.RoleAdmin: http.StatusOK} {
+		it := newImageTest(scanner.NoOp{}, role)
+
+		data := testPNG(t, "legacy")
+		err := it.bucketRepo.PutObject(context.Background(), testBucket, "legacy.png", bytes.NewReader(data), int64(len(data)), "image/png")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w := it.get("legacy.png"); w.Code != status {
+			t.Errorf("GetImage as %s = %d, want %d", role, w.Code, status)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+type CommentsController interface {
+	CreateComment(c *gin.Context)
+	GetComments(c *gin.Context)
+	UpdateComment(c *gin.Context)
+	DeleteComment(c *gin.Context)
+}
+
+type commentsController struct {
+	commentRepo repositories.CommentRepository
+	cacheRepo   repositories.CacheRepository
+}
+
+func NewCommentsController(commentRepo repositories.CommentRepository, cacheRepo repositories.CacheRepository) CommentsController {
+	return &commentsController{
+		commentRepo: commentRepo,
+		cacheRepo:   cacheRepo,
+	}
+}
+
+// CreateComment godoc
+// @Summary Comment on an article
+// @Description Add a top-level comment to an article, or a reply when parent_id is set
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param body body CreateCommentRequest true "Comment details"
+// @Success 200 {object} CommentResponseSwag
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/comments [post]
+func (h *commentsController) CreateComment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	articleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(repositories.ErrArticleNotFound)
+		return
+	}
+
+	var body CreateCommentRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	comment := models.Comment{
+		ArticleID: articleID,
+		UserID:    user.ID,
+		ParentID:  body.ParentID,
+		Content:   body.Content,
+	}
+
+	if err := h.commentRepo.CreateComment(c, &comment); err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.invalidateArticleCache(c, c.Param("id"))
+
+	c.JSON(http.StatusOK, CommentResponse{
+		Message: "Comment Created Successfully",
+		Data:    &comment,
+	})
+}
+
+// GetComments godoc
+// @Summary Get comments of an article
+// @Description Get a page of top-level comments with their replies nested below them
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Top-level comments per page"
+// @Success 200 {object} GetCommentsResponseSwag
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/comments [get]
+func (h *commentsController) GetComments(c *gin.Context) {
+	page, limit := parsePagination(c)
+
+	comments, total, err := h.commentRepo.GetComments(c, c.Param("id"), page, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, GetCommentsResponse{
+		Message: "Get Comments Successfully",
+		Data:    comments,
+		Pagination: Pagination{
+			Page:  page,
+			Limit: limit,
+			Total: total,
+		},
+	})
+}
+
+// UpdateComment godoc
+// @Summary Update a comment
+// @Description Update the content of a comment owned by the logged in user
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param commentId path string true "Comment ID"
+// @Param body body UpdateCommentRequest true "Comment details"
+// @Success 200 {object} CommentResponseSwag
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/comments/{commentId} [put]
+func (h *commentsController) UpdateComment(c *gin.Context) {
+	comment, ok := h.findOwnComment(c)
+	if !ok {
+		return
+	}
+
+	var body UpdateCommentRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	comment.Content = body.Content
+	if err := h.commentRepo.UpdateComment(c, comment); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, CommentResponse{
+		Message: "Comment updated successfully",
+		Data:    comment,
+	})
+}
+
+// DeleteComment godoc
+// @Summary Delete a comment
+// @Description Delete a comment owned by the logged in user together with its replies
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param commentId path string true "Comment ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/comments/{commentId} [delete]
+func (h *commentsController) DeleteComment(c *gin.Context) {
+	comment, ok := h.findOwnComment(c)
+	if !ok {
+		return
+	}
+
+	if err := h.commentRepo.DeleteComment(c, comment); err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.invalidateArticleCache(c, c.Param("id"))
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Comment deleted successfully",
+	})
+}
+
+// findOwnComment loads the comment addressed by the route and checks that it
+// belongs to the logged in user. It reports the error itself.
+func (h *commentsController) findOwnComment(c *gin.Context) (*models.Comment, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return nil, false
+	}
+
+	comment, err := h.commentRepo.GetCommentByID(c, c.Param("id"), c.Param("commentId"))
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	if comment.UserID != user.ID {
+		c.Error(errNotCommentOwner)
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// invalidateArticleCache drops the cached article responses so the comment
+// count is fresh on the next read.
+func (h *commentsController) invalidateArticleCache(c *gin.Context, articleID string) {
+	if err := h.cacheRepo.DeleteKey(c, "all_article", "article_"+articleID); err != nil {
+		slog.ErrorContext(c, "failed to invalidate article cache", "error", err)
+	}
+}
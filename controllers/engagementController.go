@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bookmarksCounter      = "bookmarks"
+	viewsCounter          = "views"
+	reactionCounterPrefix = "reaction:"
+)
+
+var reactionTypes = map[string]bool{
+	"like":       true,
+	"love":       true,
+	"clap":       true,
+	"insightful": true,
+}
+
+type EngagementController interface {
+	AddReaction(c *gin.Context)
+	RemoveReaction(c *gin.Context)
+	AddBookmark(c *gin.Context)
+	RemoveBookmark(c *gin.Context)
+	GetBookmarks(c *gin.Context)
+}
+
+type engagementController struct {
+	engagementRepo repositories.EngagementRepository
+	counterRepo    repositories.CounterRepository
+}
+
+func NewEngagementController(engagementRepo repositories.EngagementRepository, counterRepo repositories.CounterRepository) EngagementController {
+	return &engagementController{
+		engagementRepo: engagementRepo,
+		counterRepo:    counterRepo,
+	}
+}
+
+// AddReaction godoc
+// @Summary React to an article
+// @Description Add a reaction of the given type to an article. Reacting twice with the same type has no further effect.
+// @Tags engagement
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param type path string true "Reaction type" Enums(like, love, clap, insightful)
+// @Success 200 {object} Response
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/reactions/{type} [put]
+func (h *engagementController) AddReaction(c *gin.Context) {
+	reaction, ok := h.bindReaction(c)
+	if !ok {
+		return
+	}
+
+	created, err := h.engagementRepo.AddReaction(c, reaction)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if created {
+		if err := h.counterRepo.Incr(c, reaction.ArticleID, reactionCounterPrefix+reaction.Type, 1); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Reaction added successfully",
+	})
+}
+
+// RemoveReaction godoc
+// @Summary Remove a reaction from an article
+// @Description Remove the reaction of the given type from an article. Removing a missing reaction has no effect.
+// @Tags engagement
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param type path string true "Reaction type" Enums(like, love, clap, insightful)
+// @Success 200 {object} Response
+// @Failure 400 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/reactions/{type} [delete]
+func (h *engagementController) RemoveReaction(c *gin.Context) {
+	reaction, ok := h.bindReaction(c)
+	if !ok {
+		return
+	}
+
+	removed, err := h.engagementRepo.RemoveReaction(c, reaction)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if removed {
+		if err := h.counterRepo.Incr(c, reaction.ArticleID, reactionCounterPrefix+reaction.Type, -1); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Reaction removed successfully",
+	})
+}
+
+// AddBookmark godoc
+// @Summary Bookmark an article
+// @Description Bookmark an article for the logged in user. Bookmarking twice has no further effect.
+// @Tags engagement
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Success 200 {object} Response
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/bookmark [put]
+func (h *engagementController) AddBookmark(c *gin.Context) {
+	bookmark, ok := h.bindBookmark(c)
+	if !ok {
+		return
+	}
+
+	created, err := h.engagementRepo.AddBookmark(c, bookmark)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if created {
+		if err := h.counterRepo.Incr(c, bookmark.ArticleID, bookmarksCounter, 1); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Article bookmarked successfully",
+	})
+}
+
+// RemoveBookmark godoc
+// @Summary Remove a bookmark
+// @Description Remove an article from the bookmarks of the logged in user
+// @Tags engagement
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Success 200 {object} Response
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/bookmark [delete]
+func (h *engagementController) RemoveBookmark(c *gin.Context) {
+	bookmark, ok := h.bindBookmark(c)
+	if !ok {
+		return
+	}
+
+	removed, err := h.engagementRepo.RemoveBookmark(c, bookmark)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if removed {
+		if err := h.counterRepo.Incr(c, bookmark.ArticleID, bookmarksCounter, -1); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Bookmark removed successfully",
+	})
+}
+
+// GetBookmarks godoc
+// @Summary Get my bookmarks
+// @Description Get a page of the articles bookmarked by the logged in user, most recent first
+// @Tags engagement
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Articles per page"
+// @Success 200 {object} GetBookmarksResponseSwag
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /me/bookmarks [get]
+func (h *engagementController) GetBookmarks(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	page, limit := parsePagination(c)
+
+	articles, total, err := h.engagementRepo.GetBookmarks(c, user.ID, page, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := applyCounters(c, h.counterRepo, *articles); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, GetBookmarksResponse{
+		Message: "Get Bookmarks Successfully",
+		Data:    articles,
+		Pagination: Pagination{
+			Page:  page,
+			Limit: limit,
+			Total: total,
+		},
+	})
+}
+
+func (h *engagementController) bindReaction(c *gin.Context) (models.Reaction, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return models.Reaction{}, false
+	}
+
+	articleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || articleID < 1 {
+		c.Error(repositories.ErrArticleNotFound)
+		return models.Reaction{}, false
+	}
+
+	reactionType := c.Param("type")
+	if !reactionTypes[reactionType] {
+		c.Error(errUnknownReaction)
+		return models.Reaction{}, false
+	}
+
+	return models.Reaction{
+		UserID:    user.ID,
+		ArticleID: articleID,
+		Type:      reactionType,
+	}, true
+}
+
+func (h *engagementController) bindBookmark(c *gin.Context) (models.Bookmark, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return models.Bookmark{}, false
+	}
+
+	articleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || articleID < 1 {
+		c.Error(repositories.ErrArticleNotFound)
+		return models.Bookmark{}, false
+	}
+
+	return models.Bookmark{
+		UserID:    user.ID,
+		ArticleID: articleID,
+	}, true
+}
+
+// applyCounters sets the reaction, bookmark and view counts of each article in place.
+func applyCounters(ctx context.Context, counterRepo repositories.CounterRepository, articles []models.Article) error {
+	ids := make([]int, len(articles))
+	for i, article := range articles {
+		ids[i] = article.ID
+	}
+
+	counters, err := counterRepo.GetCounters(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range articles {
+		articles[i].Reactions = make(map[string]int64)
+		articles[i].BookmarkCount = 0
+		articles[i].ViewCount = 0
+
+		for name, value := range counters[articles[i].ID] {
+			switch {
+			case name == bookmarksCounter:
+				articles[i].BookmarkCount = value
+			case name == viewsCounter:
+				articles[i].ViewCount = value
+			case strings.HasPrefix(name, reactionCounterPrefix):
+				articles[i].Reactions[strings.TrimPrefix(name, reactionCounterPrefix)] = value
+			}
+		}
+	}
+
+	return nil
+}
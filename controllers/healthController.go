@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aliftoriq/go-crud/health"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController interface {
+	Healthz(c *gin.Context)
+	Readyz(c *gin.Context)
+}
+
+type healthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) HealthController {
+	return &healthController{checker: checker}
+}
+
+// Healthz godoc
+// @Summary Liveness probe
+// @Description Answers as long as the process is alive. It checks no dependencies
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Router /healthz [get]
+func (h *healthController) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{
+		Status: "ok",
+	})
+}
+
+// Readyz godoc
+// @Summary Readiness probe
+// @Description Checks Postgres, Redis and the MinIO bucket, each with its own timeout. Not ready while shutting down
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /readyz [get]
+func (h *healthController) Readyz(c *gin.Context) {
+	if h.checker.Draining() {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{
+			Status: "shutting down",
+			Checks: map[string]health.Result{},
+		})
+		return
+	}
+
+	checks, ready := h.checker.Check(c)
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{
+			Status: "not ready",
+			Checks: checks,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReadinessResponse{
+		Status: "ready",
+		Checks: checks,
+	})
+}
@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+type MediaController interface {
+	GetArticleMedia(c *gin.Context)
+	AttachMedia(c *gin.Context)
+	DetachMedia(c *gin.Context)
+	PurgeArticle(c *gin.Context)
+	GetMyMedia(c *gin.Context)
+}
+
+type mediaController struct {
+	mediaRepo   repositories.MediaRepository
+	arRepo      repositories.ArticleRepository
+	bucketRepo  repositories.BucketRepository
+	cacheRepo   repositories.CacheRepository
+	counterRepo repositories.CounterRepository
+	viewRepo    repositories.ViewRepository
+	bucketName  string
+	quotas      map[string]int64
+}
+
+func NewMediaController(mediaRepo repositories.MediaRepository, arRepo repositories.ArticleRepository, bucketRepo repositories.BucketRepository, cacheRepo repositories.CacheRepository, counterRepo repositories.CounterRepository, viewRepo repositories.ViewRepository, bucketName string, quotas map[string]int64) MediaController {
+	return &mediaController{
+		mediaRepo:   mediaRepo,
+		arRepo:      arRepo,
+		bucketRepo:  bucketRepo,
+		cacheRepo:   cacheRepo,
+		counterRepo: counterRepo,
+		viewRepo:    viewRepo,
+		bucketName:  bucketName,
+		quotas:      quotas,
+	}
+}
+
+// GetArticleMedia godoc
+// @Summary Get the media of an article
+// @Description Get the uploaded images attached to an article
+// @Tags media
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Success 200 {object} GetMediaResponseSwag
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/media [get]
+func (h *mediaController) GetArticleMedia(c *gin.Context) {
+	media, err := h.mediaRepo.GetMediaByArticle(c, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, GetMediaResponse{
+		Message: "Get Media Successfully",
+		Data:    media,
+	})
+}
+
+// AttachMedia godoc
+// @Summary Attach an uploaded image to an article
+// @Description Attach one of your uploaded images to your article, optionally as its cover image
+// @Tags media
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param body body AttachMediaRequest true "Media to attach"
+// @Success 200 {object} Response
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/media [post]
+func (h *mediaController) AttachMedia(c *gin.Context) {
+	user, article, ok := h.findOwnArticle(c, false)
+	if !ok {
+		return
+	}
+
+	var body AttachMediaRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user, body.ObjectName)
+	if !ok {
+		return
+	}
+
+	if media.Status != models.MediaStatusClean {
+		c.Error(errMediaNotScanned)
+		return
+	}
+
+	if err := h.mediaRepo.AttachToArticle(c, media, article.ID, body.Cover); err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.invalidateArticleCache(c, article.ID)
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Media attached successfully",
+	})
+}
+
+// DetachMedia godoc
+// @Summary Detach an image from an article
+// @Description Detach one of your images from your article. The image itself is kept.
+// @Tags media
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Param name path string true "Object name"
+// @Success 200 {object} Response
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/media/{name} [delete]
+func (h *mediaController) DetachMedia(c *gin.Context) {
+	user, article, ok := h.findOwnArticle(c, false)
+	if !ok {
+		return
+	}
+
+	media, ok := h.findOwnMedia(c, user, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	if media.ArticleID == nil || *media.ArticleID != article.ID {
+		c.Error(errMediaNotAttached)
+		return
+	}
+
+	if err := h.mediaRepo.DetachFromArticle(c, media); err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.invalidateArticleCache(c, article.ID)
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Media detached successfully",
+	})
+}
+
+// PurgeArticle godoc
+// @Summary Permanently delete an article
+// @Description Permanently delete your article, soft deleted or not, with its comments, reactions, bookmarks and attached images
+// @Tags media
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param id path string true "Article ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /articles/{id}/purge [delete]
+func (h *mediaController) PurgeArticle(c *gin.Context) {
+	_, article, ok := h.findOwnArticle(c, true)
+	if !ok {
+		return
+	}
+
+	id := strconv.Itoa(article.ID)
+
+	media, err := h.mediaRepo.GetMediaByArticle(c, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.arRepo.PurgeArticle(c, id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Remove the objects only once their rows are gone, so no row points to a
+	// deleted object. Objects left behind by a failure are orphans, which the
+	// orphaned object collection removes.
+	bucketName := h.bucketName
+	for _, m := range *media {
+		if err := deleteImageObjects(c, h.bucketRepo, bucketName, m.ObjectName); err != nil {
+			slog.ErrorContext(c, "failed to delete purged article media", "object", m.ObjectName, "error", err)
+		}
+	}
+
+	if err := h.counterRepo.Delete(c, article.ID); err != nil {
+		slog.ErrorContext(c, "failed to delete purged article counters", "error", err)
+	}
+	if err := h.viewRepo.RemoveArticle(c, article.ID); err != nil {
+		slog.ErrorContext(c, "failed to remove purged article from trending", "error", err)
+	}
+
+	h.invalidateArticleCache(c, article.ID)
+
+	c.JSON(http.StatusOK, Response{
+		Message: "Article purged successfully",
+	})
+}
+
+// GetMyMedia godoc
+// @Summary Get my media library
+// @Description Get a page of the images uploaded by the logged in user, newest first, with the storage they use and the quota
+// @Tags media
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User Token"
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Media per page"
+// @Success 200 {object} GetMyMediaResponseSwag
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /me/media [get]
+func (h *mediaController) GetMyMedia(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	page, limit := parsePagination(c)
+
+	media, total, err := h.mediaRepo.GetMediaByUser(c, user.ID, page, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	usage, err := h.mediaRepo.GetUsage(c, user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	storage := StorageUsage{
+		Count: usage.Count,
+		Bytes: usage.Bytes,
+	}
+	if quota, limited := storageQuota(user, h.quotas); limited {
+		storage.Quota = &quota
+	}
+
+	c.JSON(http.StatusOK, GetMyMediaResponse{
+		Message: "Get Media Successfully",
+		Data:    media,
+		Usage:   storage,
+		Pagination: Pagination{
+			Page:  page,
+			Limit: limit,
+			Total: total,
+		},
+	})
+}
+
+// findOwnArticle loads the article addressed by the route and checks that it
+// was written by the logged in user. It reports the error itself.
+func (h *mediaController) findOwnArticle(c *gin.Context, withDeleted bool) (models.User, *models.Article, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return user, nil, false
+	}
+
+	var article *models.Article
+	var err error
+	if withDeleted {
+		article, err = h.arRepo.GetArticleByIdUnscoped(c, c.Param("id"))
+	} else {
+		article, err = h.arRepo.GetArticleById(c, c.Param("id"))
+	}
+	if err != nil {
+		c.Error(err)
+		return user, nil, false
+	}
+
+	if article.UserID != user.ID {
+		c.Error(errNotArticleOwner)
+		return user, nil, false
+	}
+
+	return user, article, true
+}
+
+// findOwnMedia loads media by object name and checks that it was uploaded by
+// the user. It reports the error itself.
+func (h *mediaController) findOwnMedia(c *gin.Context, user models.User, objectName string) (*models.Media, bool) {
+	media, err := h.mediaRepo.GetMediaByObjectName(c, objectName)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	if media.UserID != user.ID {
+		c.Error(errNotMediaOwner)
+		return nil, false
+	}
+
+	return media, true
+}
+
+func (h *mediaController) invalidateArticleCache(c *gin.Context, articleID int) {
+	if err := h.cacheRepo.DeleteKey(c, "all_article", "article_"+strconv.Itoa(articleID)); err != nil {
+		slog.ErrorContext(c, "failed to invalidate article cache", "error", err)
+	}
+}
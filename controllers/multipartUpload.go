@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// multipartPartSize is the size of every part but the last. S3 does not
+	// accept smaller parts.
+	multipartPartSize = 5 << 20
+
+	// MultipartUploadExpiry is how long an unfinished multipart upload can be
+	// resumed before it is aborted.
+	MultipartUploadExpiry = 24 * time.Hour
+)
+
+// multipartUpload is what CreateMultipartUpload remembers until the upload is
+// completed or aborted.
+type multipartUpload struct {
+	UserID      int    `json:"user_id"`
+	ObjectName  string `json:"object_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// quarantined returns the key the upload is assembled under until it has
+// been scanned.
+func (u multipartUpload) quarantined() string {
+	return scanner.QuarantineObject(u.ObjectName)
+}
+
+// partCount returns the number of parts the upload is split into.
+func (u multipartUpload) partCount() int {
+	return int((u.Size + multipartPartSize - 1) / multipartPartSize)
+}
+
+// partSize returns the expected size of part n, counting from 1.
+func (u multipartUpload) partSize(n int) int64 {
+	if n == u.partCount() {
+		return u.Size - int64(n-1)*multipartPartSize
+	}
+	return multipartPartSize
+}
+
+// missingParts returns the part numbers that have not been uploaded with the
+// expected size yet.
+func (u multipartUpload) missingParts(parts []repositories.ObjectPart) []int {
+	uploaded := make(map[int]bool, len(parts))
+	for _, part := range parts {
+		if part.Size == u.partSize(part.PartNumber) {
+			uploaded[part.PartNumber] = true
+		}
+	}
+
+	missing := []int{}
+	for n := 1; n <= u.partCount(); n++ {
+		if !uploaded[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+// CreateMultipartUpload starts an upload that is sent in parts of part_size
+// bytes, so a large image can be uploaded over a flaky connection and resumed
+// after a failure.
+func (bc *bucketControllers) CreateMultipartUpload(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return
+	}
+
+	var body CreateMultipartUploadRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	ext, ok := imageTypes[body.ContentType]
+	if !ok {
+		c.Error(errUnsupportedType)
+		return
+	}
+
+	if body.Size <= 0 || body.Size > bc.uploads.MaxResumableSize {
+		c.Error(errImageTooLarge)
+		return
+	}
+
+	if !bc.checkQuota(c, user, body.Size) {
+		return
+	}
+
+	bucketName := bc.bucketName
+	objectName := uuid.NewString() + ext
+
+	uploadID, err := bc.bucketRepository.NewMultipartUpload(c, bucketName, scanner.QuarantineObject(objectName), body.ContentType)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	upload := multipartUpload{
+		UserID:      user.ID,
+		ObjectName:  objectName,
+		ContentType: body.ContentType,
+		Size:        body.Size,
+	}
+	value, err := json.Marshal(upload)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := bc.cacheRepository.SetKey(c, multipartUploadKey(uploadID), value, MultipartUploadExpiry); err != nil {
+		if err := bc.bucketRepository.AbortMultipartUpload(c, bucketName, scanner.QuarantineObject(objectName), uploadID); err != nil {
+			slog.ErrorContext(c, "failed to abort multipart upload", "upload_id", uploadID, "error", err)
+		}
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Upload started successfully",
+		"uploadId":  uploadID,
+		"fileName":  objectName,
+		"partSize":  multipartPartSize,
+		"partCount": upload.partCount(),
+		"expiresAt": time.Now().Add(MultipartUploadExpiry),
+	})
+}
+
+// UploadPart stores one part of a multipart upload. The raw request body is
+// the part; uploading a part again replaces it.
+func (bc *bucketControllers) UploadPart(c *gin.Context) {
+	uploadID, upload, ok := bc.findMultipartUpload(c)
+	if !ok {
+		return
+	}
+
+	partNumber, err := strconv.Atoi(c.Param("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > upload.partCount() {
+		c.Error(problem.New(http.StatusBadRequest, "invalid_part_number", fmt.Sprintf("Part number must be between 1 and %d", upload.partCount())))
+		return
+	}
+
+	size := upload.partSize(partNumber)
+	if c.Request.ContentLength < 0 {
+		c.Error(errLengthRequired)
+		return
+	}
+	if c.Request.ContentLength != size {
+		c.Error(problem.New(http.StatusBadRequest, "invalid_part_size", fmt.Sprintf("Part %d must be %d bytes", partNumber, size)))
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, size)
+	part, err := bc.bucketRepository.PutObjectPart(c, bc.bucketName, upload.quarantined(), uploadID, partNumber, body, size)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Part uploaded successfully",
+		"part":    part,
+	})
+}
+
+// GetMultipartUpload lists the parts uploaded so far and the ones still
+// missing, so an interrupted client knows where to resume.
+func (bc *bucketControllers) GetMultipartUpload(c *gin.Context) {
+	uploadID, upload, ok := bc.findMultipartUpload(c)
+	if !ok {
+		return
+	}
+
+	parts, err := bc.bucketRepository.ListObjectParts(c, bc.bucketName, upload.quarantined(), uploadID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if parts == nil {
+		parts = []repositories.ObjectPart{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Get Upload Successfully",
+		"uploadId":     uploadID,
+		"fileName":     upload.ObjectName,
+		"contentType":  upload.ContentType,
+		"size":         upload.Size,
+		"partSize":     multipartPartSize,
+		"partCount":    upload.partCount(),
+		"parts":        parts,
+		"missingParts": upload.missingParts(parts),
+	})
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the image and
+// registers it as media after checking its real content type. Objects that do
+// not match the declared type are deleted.
+func (bc *bucketControllers) CompleteMultipartUpload(c *gin.Context) {
+	uploadID, upload, ok := bc.findMultipartUpload(c)
+	if !ok {
+		return
+	}
+
+	// Checked before assembling, so the upload can still be completed once
+	// space has been freed.
+	user, _ := currentUser(c)
+	if !bc.checkQuota(c, user, upload.Size) {
+		return
+	}
+
+	bucketName := bc.bucketName
+
+	if !bc.assembleParts(c, bucketName, uploadID, upload) {
+		return
+	}
+
+	// The upload state is kept until the image is verified, so completing can
+	// be retried after a failure. An image that is rejected is deleted, so
+	// there is nothing left to retry.
+	info, err := bc.bucketRepository.StatObject(c, bucketName, upload.quarantined())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if info.Size != upload.Size {
+		bc.forgetMultipartUpload(c, uploadID)
+		bc.rejectUpload(c, bucketName, upload.ObjectName, errSizeMismatch)
+		return
+	}
+
+	contentType, err := sniffObject(c, bc.bucketRepository, bucketName, upload.quarantined())
+	if err != nil && err != errUnsupportedType {
+		c.Error(err)
+		return
+	}
+	if err != nil || contentType != upload.ContentType {
+		bc.forgetMultipartUpload(c, uploadID)
+		bc.rejectUpload(c, bucketName, upload.ObjectName, errTypeMismatch)
+		return
+	}
+
+	meta, size, err := prepareStoredImage(c, bc.bucketRepository, bucketName, upload.quarantined(), contentType, bc.uploads.StripMetadata)
+	if err == errUnreadableImage {
+		bc.forgetMultipartUpload(c, uploadID)
+		bc.rejectUpload(c, bucketName, upload.ObjectName, err)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	bc.forgetMultipartUpload(c, uploadID)
+	bc.admitUpload(c, bucketName, user, &models.Media{
+		ObjectName:  upload.ObjectName,
+		UserID:      upload.UserID,
+		ContentType: contentType,
+		Size:        size,
+		Width:       meta.Width,
+		Height:      meta.Height,
+		Format:      meta.Format,
+	})
+}
+
+// AbortMultipartUpload cancels an upload and discards its parts.
+func (bc *bucketControllers) AbortMultipartUpload(c *gin.Context) {
+	uploadID, upload, ok := bc.findMultipartUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := bc.bucketRepository.AbortMultipartUpload(c, bc.bucketName, upload.quarantined(), uploadID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	bc.forgetMultipartUpload(c, uploadID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Upload aborted successfully",
+	})
+}
+
+// assembleParts completes the multipart upload from its parts. An upload an
+// earlier attempt already assembled is left as it is. It reports the error
+// itself.
+func (bc *bucketControllers) assembleParts(c *gin.Context, bucketName string, uploadID string, upload multipartUpload) bool {
+	parts, err := bc.bucketRepository.ListObjectParts(c, bucketName, upload.quarantined(), uploadID)
+	if errors.Is(err, repositories.ErrUploadNotFound) {
+		if _, statErr := bc.bucketRepository.StatObject(c, bucketName, upload.quarantined()); statErr == nil {
+			return true
+		}
+	}
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	if missing := upload.missingParts(parts); len(missing) > 0 {
+		c.Error(errMissingParts.With("missingParts", missing))
+		return false
+	}
+
+	if err := bc.bucketRepository.CompleteMultipartUpload(c, bucketName, upload.quarantined(), uploadID, parts); err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
+}
+
+// forgetMultipartUpload deletes the state of an upload that is finished.
+func (bc *bucketControllers) forgetMultipartUpload(c *gin.Context, uploadID string) {
+	if err := bc.cacheRepository.DeleteKey(c, multipartUploadKey(uploadID)); err != nil {
+		slog.ErrorContext(c, "failed to delete multipart upload state", "upload_id", uploadID, "error", err)
+	}
+}
+
+// findMultipartUpload loads the upload addressed by the route and checks that
+// it was started by the logged in user. It reports the error itself.
+func (bc *bucketControllers) findMultipartUpload(c *gin.Context) (string, multipartUpload, bool) {
+	var upload multipartUpload
+
+	user, ok := currentUser(c)
+	if !ok {
+		c.Error(problem.ErrUnauthorized)
+		return "", upload, false
+	}
+
+	uploadID := c.Param("uploadId")
+	value, exists, err := bc.cacheRepository.GetValueByKey(c, multipartUploadKey(uploadID))
+	if err != nil {
+		c.Error(err)
+		return "", upload, false
+	}
+
+	if !exists || json.Unmarshal([]byte(value), &upload) != nil {
+		c.Error(repositories.ErrUploadNotFound)
+		return "", upload, false
+	}
+
+	if upload.UserID != user.ID {
+		c.Error(errNotUploadOwner)
+		return "", upload, false
+	}
+
+	return uploadID, upload, true
+}
+
+func multipartUploadKey(uploadID string) string {
+	return "upload_multipart_" + uploadID
+}
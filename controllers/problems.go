@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aliftoriq/go-crud/problem"
+)
+
+// The problems the controllers report themselves. Failures of the
+// repositories are reported as they are and mapped by problem.From. Problems
+// with a detail that depends on the request are created where they occur.
+var (
+	errInvalidCredentials = problem.New(http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+	errInvalidWindow      = problem.New(http.StatusBadRequest, "invalid_window", "Window must be one of 1h, 6h, 24h or 7d")
+	errInvalidFormat      = problem.New(http.StatusBadRequest, "invalid_content_format", "Content format must be plain or markdown")
+	errUnknownReaction    = problem.New(http.StatusBadRequest, "unknown_reaction", "Unknown reaction type")
+
+	errNotArticleOwner = problem.New(http.StatusForbidden, "not_article_owner", "You can only change your own articles")
+	errNotCommentOwner = problem.New(http.StatusForbidden, "not_comment_owner", "You can only change your own comments")
+	errNotMediaOwner   = problem.New(http.StatusForbidden, "not_media_owner", "You can only attach your own media")
+	errNotImageOwner   = problem.New(http.StatusForbidden, "not_image_owner", "You can only delete your own images")
+	errNotUploadOwner  = problem.New(http.StatusForbidden, "not_upload_owner", "Upload belongs to another user")
+
+	errMediaNotAttached = problem.New(http.StatusNotFound, "media_not_attached", "Media is not attached to this article")
+	errMediaNotScanned  = problem.New(http.StatusConflict, "media_not_scanned", "Media has not passed the content scan yet")
+
+	errUnsupportedType  = problem.New(http.StatusUnsupportedMediaType, "unsupported_image_type", "Only JPEG, PNG, WebP and GIF images are allowed")
+	errUnreadableImage  = problem.New(http.StatusUnsupportedMediaType, "unreadable_image", "Image could not be read")
+	errTypeMismatch     = problem.New(http.StatusUnsupportedMediaType, "image_type_mismatch", "Uploaded content does not match the declared image type")
+	errSizeMismatch     = problem.New(http.StatusBadRequest, "image_size_mismatch", "Uploaded size does not match")
+	errImageTooLarge    = problem.New(http.StatusRequestEntityTooLarge, "image_too_large", "Image is too large")
+	errImageNotUploaded = problem.New(http.StatusNotFound, "image_not_uploaded", "Image has not been uploaded yet")
+	errImageInfected    = problem.New(http.StatusUnprocessableEntity, "image_infected", "Image failed the content scan")
+	errQuotaExceeded    = problem.New(http.StatusForbidden, "storage_quota_exceeded", "Storage quota exceeded")
+	errInvalidExpiry    = problem.New(http.StatusBadRequest, "invalid_expiry", "Expiry must be a duration of at most 168h")
+	errUnknownVariant   = problem.New(http.StatusBadRequest, "unknown_variant", "Unknown image variant")
+	errResizeFailed     = problem.New(http.StatusUnprocessableEntity, "resize_failed", "Failed to resize image")
+	errLengthRequired   = problem.New(http.StatusLengthRequired, "length_required", "Content-Length is required")
+	errMissingParts     = problem.New(http.StatusBadRequest, "upload_incomplete", "Upload is missing parts")
+)
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/aliftoriq/go-crud/config"
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// storageQuota returns how many bytes of media the user may store, and false
+// if the user's storage is unlimited. A quota set on the user overrides the
+// quota of their role, as parsed by config.ParseQuotas. Roles without a quota
+// get the quota of the user role.
+func storageQuota(user models.User, quotas map[string]int64) (int64, bool) {
+	if user.StorageQuota != nil {
+		return *user.StorageQuota, true
+	}
+
+	quota, ok := quotas[user.Role]
+	if !ok {
+		quota, ok = quotas[models.RoleUser]
+	}
+
+	if !ok || quota == config.Unlimited {
+		return 0, false
+	}
+	return quota, true
+}
+
+// checkQuota reports whether the user can store size more bytes, to refuse an
+// upload before it is stored. createMedia checks again when the upload
+// becomes media. It reports the error itself.
+func (bc *bucketControllers) checkQuota(c *gin.Context, user models.User, size int64) bool {
+	quota, limited := storageQuota(user, bc.quotas)
+	if !limited {
+		return true
+	}
+
+	usage, err := bc.mediaRepository.GetUsage(c, user.ID)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+
+	if usage.Bytes+size > quota {
+		c.Error(errQuotaExceeded.With("usage", usage.Bytes).With("quota", quota))
+		return false
+	}
+
+	return true
+}
+
+// createMedia records the media of the user. When the user has a quota, the
+// quota is checked in the same transaction, so concurrent uploads cannot
+// exceed it together. It reports the error itself.
+func (bc *bucketControllers) createMedia(c *gin.Context, user models.User, media *models.Media) bool {
+	quota, limited := storageQuota(user, bc.quotas)
+	if !limited {
+		if err := bc.mediaRepository.CreateMedia(c, media); err != nil {
+			c.Error(err)
+			return false
+		}
+		return true
+	}
+
+	usage, err := bc.mediaRepository.CreateMediaWithinQuota(c, media, quota)
+	if errors.Is(err, repositories.ErrQuotaExceeded) {
+		c.Error(errQuotaExceeded.With("usage", usage.Bytes).With("quota", quota))
+		return false
+	}
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
+}
@@ -1,14 +1,24 @@
 package controllers
 
-import "github.com/aliftoriq/go-crud/models"
+import (
+	"time"
+
+	"github.com/aliftoriq/go-crud/health"
+	"github.com/aliftoriq/go-crud/models"
+)
 
 type (
 	Response struct {
 		Message string `json:"message"`
 	}
 
-	ResponseErr struct {
-		Error string `json:"error"`
+	HealthResponse struct {
+		Status string `json:"status"`
+	}
+
+	ReadinessResponse struct {
+		Status string                   `json:"status" enums:"ready,not ready,shutting down"`
+		Checks map[string]health.Result `json:"checks"`
 	}
 
 	User struct {
@@ -24,24 +34,45 @@ type (
 	}
 
 	SignupRequest struct {
-		Name     string
-		Email    string
-		Password string
+		Name  string `json:"name" binding:"required,notblank,max=100"`
+		Email string `json:"email" binding:"required,email,max=254"`
+		// Password is checked against the password policy of the
+		// configuration.
+		Password string `json:"password" binding:"required"`
 	}
 
 	LoginRequest struct {
-		Email    string `json:"email" binding:"required"`
+		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required"`
 	}
 
+	UpdateUserRequest struct {
+		Name  string `json:"name" binding:"required,notblank,max=100"`
+		Email string `json:"email" binding:"required,email,max=254"`
+	}
+
 	CreateArticleResponse struct {
 		Message string `json:"message"`
 	}
 
 	Article struct {
-		Email   string `json:"email"`
-		Title   string `json:"title"`
-		Content string `json:"content"`
+		Title         string `json:"title" binding:"required,notblank,max=200"`
+		Content       string `json:"content" binding:"required,notblank,max=100000"`
+		ContentFormat string `json:"content_format" enums:"plain,markdown" binding:"omitempty,oneof=plain markdown"`
+	}
+
+	ArticleSwag struct {
+		Article
+		UserID        int              `json:"user_id"`
+		Email         string           `json:"email"`
+		ContentHTML   string           `json:"content_html"`
+		Excerpt       string           `json:"excerpt"`
+		ReadingTime   int              `json:"reading_time"`
+		CoverImage    string           `json:"cover_image"`
+		CommentCount  int64            `json:"comment_count"`
+		Reactions     map[string]int64 `json:"reactions"`
+		BookmarkCount int64            `json:"bookmark_count"`
+		ViewCount     int64            `json:"view_count"`
 	}
 
 	GetArticlesResponse struct {
@@ -50,8 +81,8 @@ type (
 	}
 
 	GetArticlesResponseswag struct {
-		Message string     `json:"message"`
-		Data    *[]Article `json:"data"`
+		Message string         `json:"message"`
+		Data    *[]ArticleSwag `json:"data"`
 	}
 
 	GetArticleByIDResponse struct {
@@ -59,7 +90,153 @@ type (
 		Data    *models.Article `json:"data"`
 	}
 	GetArticleByIDResponseSwag struct {
+		Message string       `json:"message"`
+		Data    *ArticleSwag `json:"data"`
+	}
+
+	Pagination struct {
+		Page  int   `json:"page"`
+		Limit int   `json:"limit"`
+		Total int64 `json:"total"`
+	}
+
+	CreateCommentRequest struct {
+		Content  string `json:"content" binding:"required,notblank,max=5000"`
+		ParentID *uint  `json:"parent_id" binding:"omitempty,gt=0"`
+	}
+
+	UpdateCommentRequest struct {
+		Content string `json:"content" binding:"required,notblank,max=5000"`
+	}
+
+	CommentResponse struct {
+		Message string          `json:"message"`
+		Data    *models.Comment `json:"data"`
+	}
+
+	GetCommentsResponse struct {
+		Message    string            `json:"message"`
+		Data       *[]models.Comment `json:"data"`
+		Pagination Pagination        `json:"pagination"`
+	}
+
+	Comment struct {
+		ID        uint      `json:"ID"`
+		ArticleID int       `json:"article_id"`
+		UserID    int       `json:"user_id"`
+		ParentID  *uint     `json:"parent_id"`
+		RootID    *uint     `json:"root_id"`
+		Content   string    `json:"content"`
+		Replies   []Comment `json:"replies,omitempty"`
+	}
+
+	CommentResponseSwag struct {
 		Message string   `json:"message"`
-		Data    *Article `json:"data"`
+		Data    *Comment `json:"data"`
+	}
+
+	GetCommentsResponseSwag struct {
+		Message    string     `json:"message"`
+		Data       *[]Comment `json:"data"`
+		Pagination Pagination `json:"pagination"`
+	}
+
+	GetBookmarksResponse struct {
+		Message    string            `json:"message"`
+		Data       *[]models.Article `json:"data"`
+		Pagination Pagination        `json:"pagination"`
+	}
+
+	GetBookmarksResponseSwag struct {
+		Message    string         `json:"message"`
+		Data       *[]ArticleSwag `json:"data"`
+		Pagination Pagination     `json:"pagination"`
+	}
+
+	TrendingArticle struct {
+		Score   float64         `json:"score"`
+		Article *models.Article `json:"article"`
+	}
+
+	GetTrendingArticlesResponse struct {
+		Message string            `json:"message"`
+		Window  string            `json:"window"`
+		Data    []TrendingArticle `json:"data"`
+	}
+
+	TrendingArticleSwag struct {
+		Score   float64      `json:"score"`
+		Article *ArticleSwag `json:"article"`
+	}
+
+	GetTrendingArticlesResponseSwag struct {
+		Message string                `json:"message"`
+		Window  string                `json:"window"`
+		Data    []TrendingArticleSwag `json:"data"`
+	}
+
+	AttachMediaRequest struct {
+		ObjectName string `json:"object_name" binding:"required,max=255"`
+		Cover      bool   `json:"cover"`
+	}
+
+	GetMediaResponse struct {
+		Message string          `json:"message"`
+		Data    *[]models.Media `json:"data"`
+	}
+
+	Media struct {
+		ID           uint      `json:"ID"`
+		CreatedAt    time.Time `json:"CreatedAt"`
+		ObjectName   string    `json:"object_name"`
+		ContentType  string    `json:"content_type"`
+		Size         int64     `json:"size"`
+		VariantsSize int64     `json:"variants_size"`
+		Width        int       `json:"width"`
+		Height       int       `json:"height"`
+		Format       string    `json:"format"`
+		Status       string    `json:"status" enums:"pending,clean,failed"`
+		UserID       int       `json:"user_id"`
+		ArticleID    *int      `json:"article_id"`
+	}
+
+	GetMediaResponseSwag struct {
+		Message string   `json:"message"`
+		Data    *[]Media `json:"data"`
+	}
+
+	StorageUsage struct {
+		Count int64 `json:"count"`
+		Bytes int64 `json:"bytes"`
+		// Quota is null when the storage of the user is unlimited.
+		Quota *int64 `json:"quota"`
+	}
+
+	GetMyMediaResponse struct {
+		Message    string          `json:"message"`
+		Data       *[]models.Media `json:"data"`
+		Usage      StorageUsage    `json:"usage"`
+		Pagination Pagination      `json:"pagination"`
+	}
+
+	GetMyMediaResponseSwag struct {
+		Message    string       `json:"message"`
+		Data       *[]Media     `json:"data"`
+		Usage      StorageUsage `json:"usage"`
+		Pagination Pagination   `json:"pagination"`
+	}
+
+	PresignUploadRequest struct {
+		ContentType string `json:"content_type" binding:"required,max=100"`
+		Size        int64  `json:"size" binding:"required,gt=0"`
+	}
+
+	CompleteUploadRequest struct {
+		FileName string `json:"fileName" binding:"required,max=255"`
+	}
+
+	CreateMultipartUploadRequest struct {
+		ContentType string `json:"content_type" binding:"required,max=100"`
+		Size        int64  `json:"size" binding:"required,gt=0"`
 	}
 )
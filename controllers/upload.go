@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+	"github.com/gin-gonic/gin"
+)
+
+// imageTypes maps the image types accepted for upload to their file extension.
+// SVG is deliberately missing: it can carry scripts.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+// prepareImage strips EXIF and XMP metadata from an uploaded image if strip is
+// set, and reads the metadata that is kept. It returns errImageTooLarge for
+// images with too many pixels to turn upright and errUnreadableImage for
+// images that cannot be parsed.
+func prepareImage(ctx context.Context, data []byte, strip bool) ([]byte, images.Metadata, error) {
+	if strip {
+		stripped, err := images.StripMetadata(data)
+		if errors.Is(err, images.ErrTooManyPixels) {
+			return nil, images.Metadata{}, errImageTooLarge
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "failed to strip image metadata", "error", err)
+			return nil, images.Metadata{}, errUnreadableImage
+		}
+		data = stripped
+	}
+
+	meta, err := images.ReadMetadata(data)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to read image metadata", "error", err)
+		return nil, images.Metadata{}, errUnreadableImage
+	}
+
+	return data, meta, nil
+}
+
+// prepareStoredImage runs prepareImage on an object uploaded directly to the
+// bucket and replaces it with the stripped image. It returns the metadata and
+// the new size.
+func prepareStoredImage(c *gin.Context, bucketRepo repositories.BucketRepository, bucketName string, objectName string, contentType string, strip bool) (images.Metadata, int64, error) {
+	object, err := bucketRepo.GetObject(c, bucketName, objectName)
+	if err != nil {
+		return images.Metadata{}, 0, err
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil {
+		return images.Metadata{}, 0, err
+	}
+
+	prepared, meta, err := prepareImage(c, data, strip)
+	if err != nil {
+		return images.Metadata{}, 0, err
+	}
+
+	if !bytes.Equal(prepared, data) {
+		err := bucketRepo.PutObject(c, bucketName, objectName, bytes.NewReader(prepared), int64(len(prepared)), contentType)
+		if err != nil {
+			return images.Metadata{}, 0, err
+		}
+	}
+
+	return meta, int64(len(prepared)), nil
+}
+
+// sniffImage detects the type of an uploaded file from its first bytes rather
+// than trusting the client, and rewinds the file afterwards.
+func sniffImage(file io.ReadSeeker) (contentType string, ext string, err error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	return detectImageType(head[:n])
+}
+
+// detectImageType returns the type and extension of an image from its first
+// bytes, or errUnsupportedType if it is not an accepted image type.
+func detectImageType(head []byte) (contentType string, ext string, err error) {
+	contentType = http.DetectContentType(head)
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return "", "", errUnsupportedType
+	}
+
+	return contentType, ext, nil
+}
+
+// sniffObject detects the type of a stored object from its first bytes, or
+// returns errUnsupportedType if it is not an accepted image type.
+func sniffObject(c *gin.Context, bucketRepo repositories.BucketRepository, bucketName string, objectName string) (string, error) {
+	object, err := bucketRepo.GetObject(c, bucketName, objectName)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(object, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	contentType, _, err := detectImageType(head[:n])
+	return contentType, err
+}
+
+// deleteImageObjects deletes an uploaded image together with all of its
+// generated variants and its quarantined copy, if it was never scanned.
+func deleteImageObjects(c *gin.Context, bucketRepo repositories.BucketRepository, bucketName string, objectName string) error {
+	variants, err := bucketRepo.ListObjects(c, bucketName, images.VariantPrefix(objectName))
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		if err := bucketRepo.DeleteObject(c, bucketName, variant.Key); err != nil {
+			return err
+		}
+	}
+
+	if err := bucketRepo.DeleteObject(c, bucketName, scanner.QuarantineObject(objectName)); err != nil {
+		return err
+	}
+
+	return bucketRepo.DeleteObject(c, bucketName, objectName)
+}
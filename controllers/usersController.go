@@ -1,15 +1,16 @@
 package controllers
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/password"
 	"github.com/aliftoriq/go-crud/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UsersController interface {
@@ -23,11 +24,17 @@ type UsersController interface {
 
 type usersController struct {
 	userRepo repositories.UserRepository
+	secret   []byte
+	hasher   password.Hasher
+	policy   password.Policy
 }
 
-func NewUsersController(userRepo repositories.UserRepository) UsersController {
+func NewUsersController(userRepo repositories.UserRepository, secret string, hasher password.Hasher, policy password.Policy) UsersController {
 	return &usersController{
 		userRepo: userRepo,
+		secret:   []byte(secret),
+		hasher:   hasher,
+		policy:   policy,
 	}
 }
 
@@ -41,40 +48,40 @@ func NewUsersController(userRepo repositories.UserRepository) UsersController {
 // @Produce json
 // @Param body body SignupRequest true "User registration details"
 // @Success 200 {object} Response{}
-// @Failure 400 {object} ResponseErr{}
-// @Failure 409 {object} ResponseErr{}
-// @Failure 500 {object} ResponseErr{}
+// @Failure 400 {object} problem.Problem{}
+// @Failure 409 {object} problem.Problem{}
+// @Failure 500 {object} problem.Problem{}
 // @Router /signup [post]
 func (h *usersController) Signup(c *gin.Context) {
 	var body SignupRequest
 
-	if c.Bind(&body) != nil {
-		resp := ResponseErr{
-			Error: "FAILED TO READ BODY",
-		}
-		c.JSON(http.StatusBadRequest, resp)
+	if err := c.ShouldBind(&body); err != nil {
+		c.Error(bindError(err))
+		return
+	}
+
+	if err := h.policy.Check(body.Password); err != nil {
+		c.Error(passwordError(err))
 		return
 	}
 
 	// Check if the user with the same email already exists
 	// userRepo := repositories.NewUserRepository()
 	userRepo := h.userRepo
-	_, err := userRepo.FindUserByEmail(body.Email)
+	_, err := userRepo.FindUserByEmail(c, body.Email)
 	if err == nil {
-		resp := ResponseErr{
-			Error: "User with this email already exists",
-		}
-		c.JSON(http.StatusConflict, resp)
+		c.Error(repositories.ErrEmailTaken)
+		return
+	}
+	if !errors.Is(err, repositories.ErrUserNotFound) {
+		c.Error(err)
 		return
 	}
 
 	// Hash the user's password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
+	hashedPassword, err := h.hasher.Hash(body.Password)
 	if err != nil {
-		resp := ResponseErr{
-			Error: "Failed To Hash Password",
-		}
-		c.JSON(http.StatusBadRequest, resp)
+		c.Error(err)
 		return
 	}
 
@@ -82,14 +89,12 @@ func (h *usersController) Signup(c *gin.Context) {
 	user := models.User{
 		Name:     body.Name,
 		Email:    body.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}
 
-	if err := userRepo.CreateUser(&user); err != nil {
-		resp := ResponseErr{
-			Error: "Failed To create User",
-		}
-		c.JSON(http.StatusBadRequest, resp)
+	// Another signup with the same email may have won the race
+	if err := userRepo.CreateUser(c, &user); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -108,45 +113,45 @@ func (h *usersController) Signup(c *gin.Context) {
 // @Produce json
 // @Param body body LoginRequest true "User login details"
 // @Success 200 {object} LoginResponse{}
-// @Failure 400 {object} ResponseErr{}
-// @Failure 401 {object} ResponseErr{}
+// @Failure 400 {object} problem.Problem{}
+// @Failure 401 {object} problem.Problem{}
+// @Failure 500 {object} problem.Problem{}
 // @Router /login [post]
 func (h *usersController) Login(c *gin.Context) {
 	var body LoginRequest
 
-	if c.BindJSON(&body) != nil {
-		resp := ResponseErr{
-			Error: "FAILED TO READ BODY",
-		}
-		c.JSON(http.StatusBadRequest, resp)
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(bindError(err))
 		return
 	}
 
 	userRepo := h.userRepo
-	user, err := userRepo.FindByEmail(body.Email)
+	user, err := userRepo.FindByEmail(c, body.Email)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		c.Error(errInvalidCredentials)
+		return
+	}
 	if err != nil {
-		resp := ResponseErr{
-			Error: "Invalid Email or Password",
-		}
-		c.JSON(http.StatusUnauthorized, resp)
+		c.Error(err)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password))
+	rehash, err := h.hasher.Verify(user.Password, body.Password)
+	if errors.Is(err, password.ErrMismatch) {
+		c.Error(errInvalidCredentials)
+		return
+	}
 	if err != nil {
-		resp := ResponseErr{
-			Error: "Invalid Email or Password",
-		}
-		c.JSON(http.StatusUnauthorized, resp)
+		c.Error(err)
 		return
 	}
+	if rehash {
+		h.rehash(c, user, body.Password)
+	}
 
-	tokenString, err := generateToken(user)
+	tokenString, err := generateToken(user, h.secret)
 	if err != nil {
-		resp := ResponseErr{
-			Error: "Failed to create token",
-		}
-		c.JSON(http.StatusBadRequest, resp)
+		c.Error(err)
 		return
 	}
 
@@ -165,15 +170,32 @@ func (h *usersController) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, loginResp)
 }
 
+// rehash replaces the password hash of the user, which was made with another
+// algorithm or other parameters than those configured. The login goes on
+// when it fails; the hash is replaced on a later one.
+func (h *usersController) rehash(c *gin.Context, user *models.User, plain string) {
+	hash, err := h.hasher.Hash(plain)
+	if err != nil {
+		slog.ErrorContext(c, "failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+
+	previous := user.Password
+	user.Password = hash
+	if err := h.userRepo.UpdatePassword(c, user); err != nil {
+		user.Password = previous
+		slog.ErrorContext(c, "failed to rehash password", "user_id", user.ID, "error", err)
+	}
+}
+
 // Generate JWT token for the user
-func generateToken(user *models.User) (string, error) {
+func generateToken(user *models.User, secret []byte) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": user.ID,
 		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
 	})
 
-	jwtKey := []byte(os.Getenv("SECRET"))
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := token.SignedString(secret)
 
 	return tokenString, err
 }
@@ -183,6 +205,17 @@ func setTokenCookie(c *gin.Context, tokenString string) {
 	c.SetCookie("Authorization", tokenString, 3600*24*30, "", "", false, true)
 }
 
+// currentUser returns the user that RequireAuth stored on the context.
+func currentUser(c *gin.Context) (models.User, bool) {
+	value, exists := c.Get("user")
+	if !exists {
+		return models.User{}, false
+	}
+
+	user, ok := value.(models.User)
+	return user, ok
+}
+
 func (h *usersController) Validate(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logged in",
@@ -195,11 +228,9 @@ func (h *usersController) GetUser(c *gin.Context) {
 
 	// Fetch the user by ID from the repository
 	userRepo := h.userRepo
-	user, err := userRepo.FindByID(userID)
+	user, err := userRepo.FindByID(c, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "User not found",
-		})
+		c.Error(err)
 		return
 	}
 
@@ -212,29 +243,23 @@ func (h *usersController) UpdateUser(c *gin.Context) {
 
 	var user models.User
 	userRepo := h.userRepo
-	_, err := userRepo.FindByID(userID)
+	_, err := userRepo.FindByID(c, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "User not found",
-		})
+		c.Error(err)
 		return
 	}
 
-	var updateUser models.User
-	if err := c.Bind(&updateUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Failed to read request body",
-		})
+	var updateUser UpdateUserRequest
+	if err := c.ShouldBind(&updateUser); err != nil {
+		c.Error(bindError(err))
 		return
 	}
 
 	user.Name = updateUser.Name
 	user.Email = updateUser.Email
 
-	if err := userRepo.Update(&user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update user",
-		})
+	if err := userRepo.Update(c, &user); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -248,18 +273,14 @@ func (h *usersController) DeleteUser(c *gin.Context) {
 	userID := c.Param("id")
 
 	userRepo := h.userRepo
-	user, err := userRepo.FindByID(userID)
+	user, err := userRepo.FindByID(c, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "User not found",
-		})
+		c.Error(err)
 		return
 	}
 
-	if err := userRepo.Delete(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to delete user",
-		})
+	if err := userRepo.Delete(c, user); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aliftoriq/go-crud/password"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+)
+
+// The request bodies are validated by the binding tags of their types, with
+// the validator gin binds with. It names fields by their JSON name so the
+// field errors match the body, and knows notblank, which unlike required
+// rejects strings of only spaces.
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	v.RegisterValidation("notblank", validators.NotBlank)
+}
+
+// bindError returns the problem of a request body that failed to bind: the
+// invalid fields when it was read, or problem.ErrInvalidBody when it could
+// not be read at all.
+func bindError(err error) error {
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		fields := make([]problem.FieldError, 0, len(invalid))
+		for _, fe := range invalid {
+			fields = append(fields, problem.FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Message: fieldMessage(fe),
+			})
+		}
+		return problem.Invalid(fields)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return problem.Invalid([]problem.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type),
+		}})
+	}
+	return problem.ErrInvalidBody
+}
+
+// fieldMessage describes the failed rule of fe for humans.
+func fieldMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+
+	switch fe.Tag() {
+	case "required", "notblank":
+		return fe.Field() + " is required"
+	case "email":
+		return fe.Field() + " must be a valid email address"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s%s", fe.Field(), fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("%s must be at most %s%s", fe.Field(), fe.Param(), unit)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", fe.Field(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fe.Field() + " is invalid"
+	}
+}
+
+// passwordError returns the problem of a password the policy rejects, as a
+// field error like those of the binding tags.
+func passwordError(err error) error {
+	var weakness *password.Weakness
+	if !errors.As(err, &weakness) {
+		return err
+	}
+	return problem.Invalid([]problem.FieldError{{
+		Field:   "password",
+		Rule:    weakness.Rule,
+		Message: weakness.Error(),
+	}})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/aliftoriq/go-crud/app"
+	"github.com/aliftoriq/go-crud/jobs"
+)
+
+// runGC implements the gc subcommand, which reports orphaned objects and
+// media once and exits:
+//
+//	go-crud gc [-delete] [-grace 24h]
+func runGC(application *app.App, args []string) {
+	cfg := application.Config
+
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	deleteOrphans := flags.Bool("delete", false, "delete unreferenced objects older than the grace period")
+	grace := flags.Duration("grace", cfg.Orphans.GracePeriod, "minimum age of unreferenced objects to delete")
+	flags.Parse(args)
+
+	report, err := jobs.CollectOrphans(context.Background(), application.Repos.Media, application.Repos.Bucket, cfg.Storage.Bucket, jobs.OrphanOptions{
+		GracePeriod: *grace,
+		Delete:      *deleteOrphans,
+	})
+	if err != nil {
+		fatal("orphan collection failed", err)
+	}
+
+	jobs.LogOrphanReport(report)
+}
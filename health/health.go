@@ -0,0 +1,109 @@
+// Package health checks whether the service can take traffic.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check reports a dependency as down by returning an error.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check.
+type Result struct {
+	Status   string `json:"status" enums:"up,down"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      Check
+}
+
+// Checker runs the checks of the dependencies the service needs to be ready.
+type Checker struct {
+	checks   []check
+	draining atomic.Bool
+}
+
+// Add adds a check that fails when it takes longer than timeout.
+func (c *Checker) Add(name string, timeout time.Duration, fn Check) {
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+}
+
+// Drain marks the service as shutting down, which makes it not ready.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether Drain was called.
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Check runs all checks concurrently and reports whether all of them passed.
+func (c *Checker) Check(ctx context.Context) (map[string]Result, bool) {
+	results := make(map[string]Result, len(c.checks))
+	ready := true
+
+	var (
+		mu      sync.Mutex
+		running sync.WaitGroup
+	)
+	for _, chk := range c.checks {
+		running.Add(1)
+		go func(chk check) {
+			defer running.Done()
+			result := chk.run(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[chk.name] = result
+			if result.Status != StatusUp {
+				ready = false
+			}
+		}(chk)
+	}
+	running.Wait()
+
+	return results, ready
+}
+
+// run runs the check, giving up after its timeout even if the check ignores
+// its context.
+func (chk check) run(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, chk.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- chk.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Status:   StatusUp,
+		Duration: time.Since(start).Round(time.Microsecond).String(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,638 @@
+package images
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// strippedJPEGQuality is used when a JPEG has to be re-encoded to apply its
+// orientation. It is higher than the variant quality, as this replaces the
+// original.
+const strippedJPEGQuality = 92
+
+var errMalformed = errors.New("malformed image")
+
+// ErrTooManyPixels is returned for images with more than maxSourcePixels
+// pixels, which are not decoded.
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// decode decodes an image after checking its dimensions, so a small file
+// that declares huge dimensions cannot exhaust the memory.
+func decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Metadata is the metadata of an image that is safe to keep and show.
+// Width and Height are those of the image as displayed, i.e. after applying
+// its orientation.
+type Metadata struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+}
+
+// ReadMetadata returns the dimensions and format of an encoded image.
+func ReadMetadata(data []byte) (Metadata, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	meta := Metadata{Width: config.Width, Height: config.Height, Format: format}
+	if Orientation(data) >= 5 {
+		meta.Width, meta.Height = meta.Height, meta.Width
+	}
+	return meta, nil
+}
+
+// StripMetadata removes EXIF, XMP, IPTC and comments from a JPEG, PNG, WebP
+// or GIF image. Where the EXIF orientation says the image is stored rotated
+// or mirrored, JPEG and PNG images are turned upright and re-encoded, keeping
+// their RGB color profile; ErrTooManyPixels is returned when they are too
+// large to decode. WebP cannot be encoded here, so it keeps an EXIF block
+// with only the orientation.
+func StripMetadata(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebP(data)
+	case bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a")):
+		return stripGIF(data)
+	default:
+		return nil, errors.New("unsupported image format")
+	}
+}
+
+// Orientation returns the EXIF orientation of an encoded image, from 1 to 8,
+// or 1 if it has none.
+func Orientation(data []byte) int {
+	var exif []byte
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		exif = jpegExif(data)
+	case bytes.HasPrefix(data, pngSignature):
+		exif = pngExif(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		exif = webpExif(data)
+	}
+	return exifOrientation(exif)
+}
+
+// stripJPEG drops the APP1 (EXIF, XMP), APP3 to APP13 and APP15 (vendor data,
+// IPTC) and COM segments. APP0 (JFIF), APP2 (ICC profile) and APP14 (Adobe
+// color transform) are needed to show the image correctly and are kept.
+func stripJPEG(data []byte) ([]byte, error) {
+	if o := exifOrientation(jpegExif(data)); o > 1 {
+		img, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, orient(img, o), &jpeg.Options{Quality: strippedJPEGQuality}); err != nil {
+			return nil, err
+		}
+
+		// The profile goes right after the start of image
+		encoded := buf.Bytes()
+		out := append(make([]byte, 0, len(encoded)), encoded[:2]...)
+		for _, segment := range jpegICC(data) {
+			out = append(out, segment...)
+		}
+		return append(out, encoded[2:]...), nil
+	}
+
+	out := make([]byte, 0, len(data))
+	err := walkJPEG(data, func(marker byte, segment []byte) {
+		if keepJPEGSegment(marker) {
+			out = append(out, segment...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func keepJPEGSegment(marker byte) bool {
+	switch {
+	case marker == 0xe0 || marker == 0xe2 || marker == 0xee:
+		return true
+	case marker >= 0xe1 && marker <= 0xef, marker == 0xfe:
+		return false
+	default:
+		return true
+	}
+}
+
+// walkJPEG calls fn for every segment before the image data, with the
+// segment's marker and bytes including the marker. Everything from the first
+// start of scan on is passed as a single segment.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte)) error {
+	fn(0xd8, data[:2])
+
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return errMalformed
+		}
+
+		start := pos
+		for pos < len(data) && data[pos] == 0xff {
+			pos++
+		}
+		if pos >= len(data) {
+			return errMalformed
+		}
+		marker := data[pos]
+		pos++
+
+		switch {
+		case marker == 0xda || marker == 0xd9:
+			fn(marker, data[start:])
+			return nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			fn(marker, data[start:pos])
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return errMalformed
+		}
+		end := pos + int(binary.BigEndian.Uint16(data[pos:]))
+		if end > len(data) || end < pos+2 {
+			return errMalformed
+		}
+		fn(marker, data[start:end])
+		pos = end
+	}
+}
+
+// jpegICC returns the APP2 segments that hold the ICC profile of a JPEG, if
+// it has an RGB profile. The re-encoded image is always RGB, so other
+// profiles would not match it.
+func jpegICC(data []byte) [][]byte {
+	var segments [][]byte
+	walkJPEG(data, func(marker byte, segment []byte) {
+		// Marker, length, "ICC_PROFILE\0", sequence number and count come
+		// first
+		if marker == 0xe2 && len(segment) > 18 && string(segment[4:16]) == "ICC_PROFILE\x00" {
+			segments = append(segments, segment)
+		}
+	})
+
+	// The color space is in the profile header, in the first segment
+	for _, segment := range segments {
+		if segment[16] == 1 {
+			if profile := segment[18:]; len(profile) >= 20 && string(profile[16:20]) == "RGB " {
+				return segments
+			}
+		}
+	}
+	return nil
+}
+
+// jpegExif returns the TIFF data of the EXIF segment of a JPEG, if any.
+func jpegExif(data []byte) []byte {
+	var exif []byte
+	walkJPEG(data, func(marker byte, segment []byte) {
+		// Marker, length and the "Exif\0\0" identifier come first
+		if exif == nil && marker == 0xe1 && len(segment) > 10 && string(segment[4:10]) == "Exif\x00\x00" {
+			exif = segment[10:]
+		}
+	})
+	return exif
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngDroppedChunks are the PNG chunks with metadata. XMP is stored in iTXt.
+var pngDroppedChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if o := exifOrientation(pngExif(data)); o > 1 {
+		img, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, orient(img, o)); err != nil {
+			return nil, err
+		}
+
+		iccp := pngICC(data)
+		if iccp == nil {
+			return buf.Bytes(), nil
+		}
+		// The profile must come before the image data; it goes right after
+		// the header
+		out := append(make([]byte, 0, buf.Len()+len(iccp)), pngSignature...)
+		err = walkPNG(buf.Bytes(), func(kind string, chunk []byte) {
+			out = append(out, chunk...)
+			if kind == "IHDR" {
+				out = append(out, iccp...)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	out := append(make([]byte, 0, len(data)), pngSignature...)
+	err := walkPNG(data, func(kind string, chunk []byte) {
+		if !pngDroppedChunks[kind] {
+			out = append(out, chunk...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// walkPNG calls fn for every chunk with its type and bytes, including length,
+// type and CRC.
+func walkPNG(data []byte, fn func(kind string, chunk []byte)) error {
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) || end < pos {
+			return errMalformed
+		}
+
+		kind := string(data[pos+4 : pos+8])
+		fn(kind, data[pos:end])
+		pos = end
+
+		if kind == "IEND" {
+			return nil
+		}
+	}
+	return errMalformed
+}
+
+// pngICC returns the iCCP chunk of a PNG, if it has an RGB profile. The
+// re-encoded image is always RGB, so other profiles would not match it.
+func pngICC(data []byte) []byte {
+	var iccp []byte
+	walkPNG(data, func(kind string, chunk []byte) {
+		if iccp == nil && kind == "iCCP" {
+			iccp = chunk
+		}
+	})
+	if iccp == nil {
+		return nil
+	}
+
+	// The profile name, a null byte and the compression method come before
+	// the zlib compressed profile
+	body := iccp[8 : len(iccp)-4]
+	nul := bytes.IndexByte(body, 0)
+	if nul < 0 || nul+2 > len(body) {
+		return nil
+	}
+	profile, err := zlib.NewReader(bytes.NewReader(body[nul+2:]))
+	if err != nil {
+		return nil
+	}
+	defer profile.Close()
+
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(profile, header); err != nil || string(header[16:20]) != "RGB " {
+		return nil
+	}
+	return iccp
+}
+
+func pngExif(data []byte) []byte {
+	var exif []byte
+	walkPNG(data, func(kind string, chunk []byte) {
+		if exif == nil && kind == "eXIf" {
+			exif = chunk[8 : len(chunk)-4]
+		}
+	})
+	return exif
+}
+
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	orientation := exifOrientation(webpExif(data))
+
+	out := append(make([]byte, 0, len(data)), data[:12]...)
+	err := walkWebP(data, func(fourCC string, chunk []byte) {
+		switch fourCC {
+		case "EXIF", "XMP ":
+			return
+		case "VP8X":
+			vp8x := append([]byte(nil), chunk...)
+			vp8x[8] &^= webpFlagXMP
+			if orientation > 1 {
+				vp8x[8] |= webpFlagEXIF
+			} else {
+				vp8x[8] &^= webpFlagEXIF
+			}
+			chunk = vp8x
+		}
+		out = append(out, chunk...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if orientation > 1 {
+		exif := orientationExif(orientation)
+		header := make([]byte, 8)
+		copy(header, "EXIF")
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(exif)))
+		out = append(append(out, header...), exif...)
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// walkWebP calls fn for every chunk of a RIFF WebP file with its FourCC and
+// bytes, including the header and padding.
+func walkWebP(data []byte, fn func(fourCC string, chunk []byte)) error {
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end < pos || end > len(data) {
+			// Some encoders leave out the padding of the last chunk
+			if end == len(data)+1 && size%2 == 1 {
+				end = len(data)
+			} else {
+				return errMalformed
+			}
+		}
+
+		fourCC := string(data[pos : pos+4])
+		if fourCC == "VP8X" && size < 10 {
+			return errMalformed
+		}
+		fn(fourCC, data[pos:end])
+		pos = end
+	}
+	return nil
+}
+
+func webpExif(data []byte) []byte {
+	var exif []byte
+	walkWebP(data, func(fourCC string, chunk []byte) {
+		if exif == nil && fourCC == "EXIF" {
+			exif = bytes.TrimPrefix(chunk[8:], []byte("Exif\x00\x00"))
+		}
+	})
+	return exif
+}
+
+// gifKeptApplications are the application extensions needed to show a GIF:
+// animation loops and color profiles. XMP is dropped.
+var gifKeptApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+	"ICCRGBG1012": true,
+}
+
+// stripGIF drops comment extensions and application extensions other than
+// those in gifKeptApplications. GIF has no EXIF orientation.
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 {
+		return nil, errMalformed
+	}
+
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+	if pos > len(data) {
+		return nil, errMalformed
+	}
+	out := append(make([]byte, 0, len(data)), data[:pos]...)
+
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x3b:
+			return append(out, 0x3b), nil
+
+		case 0x21:
+			if pos+2 > len(data) {
+				return nil, errMalformed
+			}
+			label := data[pos+1]
+			end, err := skipGIFSubBlocks(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+
+			keep := label != 0xfe
+			if label == 0xff {
+				keep = start+14 <= len(data) && data[start+2] == 11 && gifKeptApplications[string(data[start+3:start+14])]
+			}
+			if keep {
+				out = append(out, data[start:end]...)
+			}
+
+		case 0x2c:
+			if pos+10 > len(data) {
+				return nil, errMalformed
+			}
+			pos += 10
+			if flags := data[start+9]; flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			// LZW minimum code size, then the image data
+			end, err := skipGIFSubBlocks(data, pos+1)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			out = append(out, data[start:end]...)
+
+		default:
+			return nil, errMalformed
+		}
+	}
+
+	return nil, errMalformed
+}
+
+// skipGIFSubBlocks returns the position after the data sub-blocks starting at
+// pos and their terminator.
+func skipGIFSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errMalformed
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// exifOrientation reads the Orientation tag from the first IFD of TIFF
+// formatted EXIF data, returning 1 if it is missing or invalid.
+func exifOrientation(exif []byte) int {
+	if len(exif) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > len(exif) {
+		return 1
+	}
+
+	entries := int(order.Uint16(exif[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(exif) {
+			return 1
+		}
+		// Orientation is a SHORT stored in the value field itself
+		if order.Uint16(exif[entry:]) == 0x0112 && order.Uint16(exif[entry+2:]) == 3 {
+			if o := int(order.Uint16(exif[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orientationExif returns TIFF formatted EXIF data with only an Orientation
+// tag.
+func orientationExif(orientation int) []byte {
+	exif := make([]byte, 26)
+	copy(exif, "II")
+	binary.LittleEndian.PutUint16(exif[2:], 42)
+	binary.LittleEndian.PutUint32(exif[4:], 8)
+	binary.LittleEndian.PutUint16(exif[8:], 1)
+	binary.LittleEndian.PutUint16(exif[10:], 0x0112)
+	binary.LittleEndian.PutUint16(exif[12:], 3)
+	binary.LittleEndian.PutUint32(exif[14:], 1)
+	binary.LittleEndian.PutUint16(exif[18:], uint16(orientation))
+	// The offset of the next IFD stays 0: there is none
+	return exif
+}
+
+// orient turns an image stored with the given EXIF orientation upright.
+// Images that are not RGBA or NRGBA are converted to RGBA first, so the
+// pixels can be moved as bytes.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	switch src := img.(type) {
+	case *image.NRGBA:
+		dst := image.NewNRGBA(orientedBounds(src.Rect, orientation))
+		orientPix(dst.Pix, dst.Stride, src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):], src.Stride, src.Rect, orientation)
+		return dst
+	case *image.RGBA:
+		dst := image.NewRGBA(orientedBounds(src.Rect, orientation))
+		orientPix(dst.Pix, dst.Stride, src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):], src.Stride, src.Rect, orientation)
+		return dst
+	default:
+		b := img.Bounds()
+		rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+		return orient(rgba, orientation)
+	}
+}
+
+// orientedBounds returns the bounds of an image of size b once it is turned
+// upright.
+func orientedBounds(b image.Rectangle, orientation int) image.Rectangle {
+	if orientation >= 5 {
+		return image.Rect(0, 0, b.Dy(), b.Dx())
+	}
+	return image.Rect(0, 0, b.Dx(), b.Dy())
+}
+
+// orientPix copies the 4 byte pixels of a w×h source, starting at its top
+// left pixel, to dst turned upright.
+func orientPix(dst []byte, dstStride int, src []byte, srcStride int, b image.Rectangle, orientation int) {
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	for y := 0; y < dh; y++ {
+		row := dst[y*dstStride:]
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs 90° counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(row[x*4:x*4+4], src[sy*srcStride+sx*4:])
+		}
+	}
+}
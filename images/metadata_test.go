@@ -0,0 +1,190 @@
+package images
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// marked returns a w×h white image with a red size×size square in the top
+// left corner. JPEG needs a square of a few pixels to keep it red.
+func marked(w, h, size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	return img
+}
+
+// iccProfile returns the start of an ICC profile with the color space.
+func iccProfile(colorSpace string) []byte {
+	profile := make([]byte, 128)
+	copy(profile[16:], colorSpace)
+	return profile
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// orientedJPEG encodes img with an EXIF orientation and an ICC profile.
+func orientedJPEG(t *testing.T, img image.Image, orientation int, colorSpace string) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	icc := append([]byte("ICC_PROFILE\x00\x01\x01"), iccProfile(colorSpace)...)
+	out := append([]byte(nil), encoded[:2]...)
+	out = append(out, jpegSegment(0xe1, append([]byte("Exif\x00\x00"), orientationExif(orientation)...))...)
+	out = append(out, jpegSegment(0xe2, icc)...)
+	return append(out, encoded[2:]...)
+}
+
+func pngChunk(kind string, body []byte) []byte {
+	chunk := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, body...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// orientedPNG encodes img with an EXIF orientation and an ICC profile.
+func orientedPNG(t *testing.T, img image.Image, orientation int, colorSpace string) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var profile bytes.Buffer
+	zw := zlib.NewWriter(&profile)
+	zw.Write(iccProfile(colorSpace))
+	zw.Close()
+	iccp := append([]byte("icc\x00\x00"), profile.Bytes()...)
+
+	out := append([]byte(nil), pngSignature...)
+	err := walkPNG(buf.Bytes(), func(kind string, chunk []byte) {
+		out = append(out, chunk...)
+		if kind == "IHDR" {
+			out = append(out, pngChunk("eXIf", orientationExif(orientation))...)
+			out = append(out, pngChunk("iCCP", iccp)...)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// assertUpright checks that a w×h image marked with an 8 pixel square and
+// stored with orientation 6 was turned 90° clockwise.
+func assertUpright(t *testing.T, data []byte, w, h int) {
+	t.Helper()
+
+	if o := Orientation(data); o != 1 {
+		t.Errorf("orientation = %d, want none", o)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != h || b.Dy() != w {
+		t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), h, w)
+	}
+	if r, g, _, _ := img.At(h-4, 3).RGBA(); r < 0xc000 || g > 0x4000 {
+		t.Errorf("the mark is not in the top right corner")
+	}
+}
+
+func TestStripJPEGTurnsUprightAndKeepsRGBProfile(t *testing.T) {
+	stripped, err := StripMetadata(orientedJPEG(t, marked(32, 16, 8), 6, "RGB "))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUpright(t, stripped, 32, 16)
+	if jpegExif(stripped) != nil {
+		t.Error("EXIF was kept")
+	}
+	if jpegICC(stripped) == nil {
+		t.Error("ICC profile was dropped")
+	}
+}
+
+func TestStripJPEGDropsProfileOfOtherColorSpace(t *testing.T) {
+	stripped, err := StripMetadata(orientedJPEG(t, marked(32, 16, 8), 6, "GRAY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("ICC_PROFILE")) {
+		t.Error("GRAY profile was kept on an RGB image")
+	}
+}
+
+func TestStripPNGTurnsUprightAndKeepsRGBProfile(t *testing.T) {
+	stripped, err := StripMetadata(orientedPNG(t, marked(32, 16, 8), 6, "RGB "))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertUpright(t, stripped, 32, 16)
+	if pngExif(stripped) != nil {
+		t.Error("EXIF was kept")
+	}
+	if pngICC(stripped) == nil {
+		t.Error("ICC profile was dropped")
+	}
+}
+
+func TestStripRejectsTooManyPixels(t *testing.T) {
+	data := orientedJPEG(t, marked(8, 8, 1), 6, "RGB ")
+
+	// Declare 60000×60000 in the frame header
+	sof := bytes.Index(data, []byte{0xff, 0xc0})
+	if sof < 0 {
+		t.Fatal("no frame header")
+	}
+	binary.BigEndian.PutUint16(data[sof+5:], 60000)
+	binary.BigEndian.PutUint16(data[sof+7:], 60000)
+
+	if _, err := StripMetadata(data); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("err = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestOrientMatchesEveryOrientation(t *testing.T) {
+	src := marked(3, 2, 1)
+	// The generic path converts to RGBA first
+	paletted := image.NewPaletted(src.Rect, color.Palette{color.White, color.NRGBA{R: 0xff, A: 0xff}})
+	paletted.SetColorIndex(0, 0, 1)
+
+	// Where the mark ends up, for each orientation
+	want := map[int]image.Point{
+		2: {2, 0}, 3: {2, 1}, 4: {0, 1},
+		5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2},
+	}
+
+	for orientation, mark := range want {
+		for _, img := range []image.Image{src, paletted} {
+			got := orient(img, orientation)
+			if r, g, _, _ := got.At(mark.X, mark.Y).RGBA(); r != 0xffff || g != 0 {
+				t.Errorf("orientation %d of %T: mark is not at %v", orientation, img, mark)
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FitContain = "fit"
+	FitCover   = "fill"
+
+	// MaxDimension bounds the width and height of a requested variant.
+	MaxDimension = 2048
+	// maxSourcePixels guards against decompression bombs.
+	maxSourcePixels = 50_000_000
+
+	jpegQuality = 85
+
+	// VariantsDir is the prefix of every variant object.
+	VariantsDir = "variants/"
+
+	// DefaultVariants is used when IMAGE_VARIANTS is not set.
+	DefaultVariants = "thumb=200x200:fill,medium=800x800:fit,large=1600x1600:fit"
+)
+
+// Variant describes a resized rendition of an uploaded image.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Fit    string
+}
+
+// ParseVariants parses a comma separated list of name=WIDTHxHEIGHT:fit
+// definitions, e.g. "thumb=200x200:fill,large=1600x1600:fit".
+func ParseVariants(spec string) (map[string]Variant, error) {
+	variants := make(map[string]Variant)
+
+	for _, def := range strings.Split(spec, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(def, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid image variant %q: missing '='", def)
+		}
+
+		size, fit, ok := strings.Cut(rest, ":")
+		if !ok {
+			fit = FitContain
+		}
+
+		w, h, ok := strings.Cut(size, "x")
+		if !ok {
+			return nil, fmt.Errorf("invalid image variant %q: size must be WIDTHxHEIGHT", def)
+		}
+
+		variant, err := NewVariant(w, h, fit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image variant %q: %w", def, err)
+		}
+
+		variant.Name = name
+		variants[name] = variant
+	}
+
+	return variants, nil
+}
+
+// NewVariant builds an unnamed variant from raw width, height and fit values,
+// as given in a query string. Either width or height may be empty.
+func NewVariant(width string, height string, fit string) (Variant, error) {
+	v := Variant{Fit: fit}
+	if v.Fit == "" {
+		v.Fit = FitContain
+	}
+	if v.Fit != FitContain && v.Fit != FitCover {
+		return Variant{}, errors.New("fit must be fit or fill")
+	}
+
+	var err error
+	if width != "" {
+		if v.Width, err = strconv.Atoi(width); err != nil {
+			return Variant{}, errors.New("width must be a number")
+		}
+	}
+	if height != "" {
+		if v.Height, err = strconv.Atoi(height); err != nil {
+			return Variant{}, errors.New("height must be a number")
+		}
+	}
+
+	if v.Width < 0 || v.Height < 0 || v.Width > MaxDimension || v.Height > MaxDimension {
+		return Variant{}, fmt.Errorf("width and height must be between 1 and %d", MaxDimension)
+	}
+	if v.Width == 0 && v.Height == 0 {
+		return Variant{}, errors.New("width or height is required")
+	}
+	if v.Fit == FitCover && (v.Width == 0 || v.Height == 0) {
+		return Variant{}, errors.New("fill needs both width and height")
+	}
+
+	return v, nil
+}
+
+// AdHocSizes are the widths and heights variants requested by size are
+// rounded up to. Every distinct variant is stored, so without them a client
+// could fill the bucket with one variant per pixel.
+var AdHocSizes = []int{128, 256, 512, 768, 1024, 1536, MaxDimension}
+
+// Snap rounds the width and height of an ad hoc variant up to the next of
+// AdHocSizes, so the image is at least as large as requested. A fill variant
+// is a crop of the requested aspect ratio, so only its larger side is rounded
+// and the other is scaled by the same factor.
+func (v Variant) Snap() Variant {
+	if v.Fit != FitCover {
+		v.Width = snapSize(v.Width)
+		v.Height = snapSize(v.Height)
+		return v
+	}
+
+	if v.Width >= v.Height {
+		v.Width, v.Height = snapScaled(v.Width, v.Height)
+	} else {
+		v.Height, v.Width = snapScaled(v.Height, v.Width)
+	}
+	return v
+}
+
+// snapScaled rounds larger up to the next of AdHocSizes and scales smaller by
+// the same factor.
+func snapScaled(larger int, smaller int) (int, int) {
+	snapped := snapSize(larger)
+	scaled := int(float64(smaller)*float64(snapped)/float64(larger) + 0.5)
+	return snapped, maxInt(1, scaled)
+}
+
+func snapSize(size int) int {
+	if size == 0 {
+		return 0
+	}
+	for _, step := range AdHocSizes {
+		if size <= step {
+			return step
+		}
+	}
+	return MaxDimension
+}
+
+// VariantPrefix is the prefix of every variant object of an original object.
+func VariantPrefix(objectName string) string {
+	return VariantsDir + objectName + "/"
+}
+
+// ObjectName returns the name under which the variant of objectName is stored.
+func (v Variant) ObjectName(objectName string, ext string) string {
+	name := v.Name
+	if name == "" {
+		name = fmt.Sprintf("w%d_h%d_%s", v.Width, v.Height, v.Fit)
+	}
+	return VariantPrefix(objectName) + name + ext
+}
+
+// OutputType returns the content type and extension a variant of an image of
+// the given content type is encoded to. WebP cannot be encoded, so it becomes
+// JPEG; GIF variants keep only the first frame and become PNG.
+func OutputType(contentType string) (string, string) {
+	switch contentType {
+	case "image/png", "image/gif":
+		return "image/png", ".png"
+	default:
+		return "image/jpeg", ".jpg"
+	}
+}
+
+// Resize decodes src, turns it upright according to its EXIF orientation,
+// resizes it according to the variant and encodes it to the given output
+// content type.
+func Resize(src io.Reader, v Variant, outputType string) ([]byte, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resized := resize(orient(img, Orientation(data)), v)
+
+	var buf bytes.Buffer
+	switch outputType {
+	case "image/png":
+		err = png.Encode(&buf, resized)
+	default:
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func resize(img image.Image, v Variant) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	if v.Fit == FitCover {
+		// Scale to cover the box, then crop the center.
+		scale := maxFloat(float64(v.Width)/float64(srcW), float64(v.Height)/float64(srcH))
+		cropW := minInt(srcW, int(float64(v.Width)/scale+0.5))
+		cropH := minInt(srcH, int(float64(v.Height)/scale+0.5))
+		x0 := bounds.Min.X + (srcW-cropW)/2
+		y0 := bounds.Min.Y + (srcH-cropH)/2
+
+		dst := image.NewRGBA(image.Rect(0, 0, v.Width, v.Height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x0, y0, x0+cropW, y0+cropH), draw.Over, nil)
+		return dst
+	}
+
+	// Scale to fit inside the box without upscaling.
+	scale := 1.0
+	if v.Width > 0 {
+		scale = float64(v.Width) / float64(srcW)
+	}
+	if v.Height > 0 {
+		if s := float64(v.Height) / float64(srcH); v.Width == 0 || s < scale {
+			scale = s
+		}
+	}
+	if scale >= 1 {
+		return img
+	}
+
+	dstW := maxInt(1, int(float64(srcW)*scale+0.5))
+	dstH := maxInt(1, int(float64(srcH)*scale+0.5))
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,42 @@
+package images
+
+import "testing"
+
+func TestSnapRoundsUpToAdHocSizes(t *testing.T) {
+	tests := []struct {
+		width, height int
+		wantW, wantH  int
+	}{
+		{300, 0, 512, 0},
+		{0, 128, 0, 128},
+		{1, 129, 128, 256},
+		{2000, 1025, MaxDimension, 1536},
+	}
+
+	for _, tt := range tests {
+		got := Variant{Width: tt.width, Height: tt.height, Fit: FitContain}.Snap()
+		if got.Width != tt.wantW || got.Height != tt.wantH || got.Fit != FitContain {
+			t.Errorf("Snap of %dx%d = %dx%d %s, want %dx%d fit", tt.width, tt.height, got.Width, got.Height, got.Fit, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestSnapKeepsAspectRatioOfFill(t *testing.T) {
+	tests := []struct {
+		width, height int
+		wantW, wantH  int
+	}{
+		{300, 200, 512, 341},
+		{200, 300, 341, 512},
+		{100, 100, 128, 128},
+		{2000, 1000, MaxDimension, 1024},
+		{1000, 1, 1024, 1},
+	}
+
+	for _, tt := range tests {
+		got := Variant{Width: tt.width, Height: tt.height, Fit: FitCover}.Snap()
+		if got.Width != tt.wantW || got.Height != tt.wantH || got.Fit != FitCover {
+			t.Errorf("Snap of %dx%d = %dx%d %s, want %dx%d fill", tt.width, tt.height, got.Width, got.Height, got.Fit, tt.wantW, tt.wantH)
+		}
+	}
+}
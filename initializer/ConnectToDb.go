@@ -1,32 +1,26 @@
 package initializer
 
 import (
-	"os"
+	"fmt"
+
+	"github.com/aliftoriq/go-crud/logging"
+	"github.com/aliftoriq/go-crud/metrics"
+	"github.com/aliftoriq/go-crud/tracing"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// type Database interface {
-// }
-
-// type database struct {
-// 	DB *gorm.DB
-// }
-
-// func NewDatabase() Database {
-// 	db := ConnectToDb()
-// 	return &database{DB: db}
-// }
-
-var DB *gorm.DB
-
-func ConnectToDb() {
-	var err error
-	dsn := os.Getenv("DB")
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-
+func ConnectToDb(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logging.GORM{}})
 	if err != nil {
-		panic("FAILED TO CONNECT THE DATABASE")
+		return nil, fmt.Errorf("FAILED TO CONNECT THE DATABASE: %w", err)
+	}
+	if err := db.Use(metrics.GORM{}); err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.GORM{}); err != nil {
+		return nil, err
 	}
+	return db, nil
 }
@@ -2,28 +2,26 @@ package initializer
 
 import (
 	"fmt"
-	"log"
-	"os"
 
+	"github.com/aliftoriq/go-crud/config"
+	"github.com/aliftoriq/go-crud/tracing"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-var Client *minio.Client
-
-func ConnectToMinio() {
-	endpoint := os.Getenv("ENDPOINT")
-	accessKey := os.Getenv("ACCESKEY")
-	secretKey := os.Getenv("SECRETKEY")
+func ConnectToMinio(cfg config.Minio) (*minio.Client, error) {
+	transport, err := minio.DefaultTransport(false)
+	if err != nil {
+		return nil, fmt.Errorf("FAILED TO CREATE THE MINIO CLIENT: %w", err)
+	}
 
-	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: false,
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:    false,
+		Transport: tracing.Transport("minio", transport),
 	})
 	if err != nil {
-		fmt.Println("minio client")
-		log.Fatalln(err)
+		return nil, fmt.Errorf("FAILED TO CREATE THE MINIO CLIENT: %w", err)
 	}
-
-	Client = minioClient
+	return client, nil
 }
@@ -1,23 +1,21 @@
 package initializer
 
 import (
-	"os"
+	"fmt"
 
+	"github.com/aliftoriq/go-crud/config"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
-var RedisClient *redis.Client
-
-func ConnectToRedis() {
-
-	addr := os.Getenv("REDIS_ADDR")
-	password := os.Getenv("REDIS_PASSWORD")
-
+func ConnectToRedis(cfg config.Redis) (*redis.Client, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       0,
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	})
-
-	RedisClient = client
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		return nil, fmt.Errorf("FAILED TO INSTRUMENT THE REDIS CLIENT: %w", err)
+	}
+	return client, nil
 }
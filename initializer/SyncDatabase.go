@@ -1,8 +1,66 @@
 package initializer
 
-import Models "github.com/aliftoriq/go-crud/models"
+import (
+	"log/slog"
 
-func SyncDatabase() {
-	// DB.Migrator().DropTable(&Models.Article{})
-	DB.AutoMigrate(&Models.User{}, &Models.Article{})
+	"github.com/aliftoriq/go-crud/content"
+	Models "github.com/aliftoriq/go-crud/models"
+	"gorm.io/gorm"
+)
+
+func SyncDatabase(db *gorm.DB) error {
+	// db.Migrator().DropTable(&Models.Article{})
+	err := db.AutoMigrate(&Models.User{}, &Models.Article{}, &Models.Comment{}, &Models.Reaction{}, &Models.Bookmark{}, &Models.ArticleCounter{}, &Models.Media{})
+	if err != nil {
+		return err
+	}
+
+	backfillArticleAuthors(db)
+	backfillRenderedContent(db)
+	return nil
+}
+
+// backfillArticleAuthors links the articles created before user_id existed
+// to the user with their email. Articles whose email no user has are left
+// alone.
+func backfillArticleAuthors(db *gorm.DB) {
+	emails := db.Unscoped().Model(&Models.User{}).Select("email")
+	author := db.Unscoped().Model(&Models.User{}).Select("id").Where("users.email = articles.email")
+	err := db.Unscoped().Model(&Models.Article{}).
+		Where("user_id IS NULL AND email IN (?)", emails).
+		UpdateColumn("user_id", author).Error
+	if err != nil {
+		slog.Error("failed to backfill article authors", "error", err)
+	}
+}
+
+// backfillRenderedContent renders the articles created before content_html
+// existed, so reads never have to render. Only those have a NULL
+// content_html: every article saved since has its rendered content, which is
+// empty for empty content.
+func backfillRenderedContent(db *gorm.DB) {
+	var articles []Models.Article
+	if err := db.Where("content_html IS NULL").Find(&articles).Error; err != nil {
+		slog.Error("failed to find articles to render", "error", err)
+		return
+	}
+
+	for _, article := range articles {
+		rendered, err := content.Render(article.ContentFormat, article.Content)
+		if err != nil {
+			slog.Error("failed to render article", "article_id", article.ID, "error", err)
+			continue
+		}
+
+		// Select writes the empty strings and zeros too, so the article is
+		// not rendered again
+		err = db.Model(&article).Select("content_html", "excerpt", "reading_time").Updates(Models.Article{
+			ContentHTML: rendered.HTML,
+			Excerpt:     rendered.Excerpt,
+			ReadingTime: rendered.ReadingTime,
+		}).Error
+		if err != nil {
+			slog.Error("failed to save rendered article", "article_id", article.ID, "error", err)
+		}
+	}
 }
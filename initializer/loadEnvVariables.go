@@ -1,15 +0,0 @@
-package initializer
-
-import (
-	"log"
-
-	"github.com/joho/godotenv"
-)
-
-func LoadEnvVariables() {
-	err := godotenv.Load()
-
-	if err != nil {
-		log.Fatal("salah")
-	}
-}
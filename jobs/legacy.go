@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+)
+
+// RegisterLegacyObjects records media for the images uploaded before media
+// were recorded: the images in the bucket that are older than the oldest media
+// and that no media refers to. Younger images without media are orphans and
+// are left to CollectOrphans. The media are recorded as pending and without a
+// user, so ScanPendingMedia scans the images before they are served again.
+func RegisterLegacyObjects(ctx context.Context, mediaRepo repositories.MediaRepository, bucketRepo repositories.BucketRepository, bucketName string) error {
+	cutoff := time.Now()
+	oldest, err := mediaRepo.GetOldestMedia(ctx)
+	if err == nil {
+		cutoff = oldest.CreatedAt
+	} else if !errors.Is(err, repositories.ErrMediaNotFound) {
+		return err
+	}
+
+	names, err := mediaRepo.GetAllObjectNames(ctx)
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool, len(names))
+	for _, name := range names {
+		referenced[name] = true
+	}
+
+	objects, err := bucketRepo.ListObjects(ctx, bucketName, "")
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		if referenced[object.Key] || !object.LastModified.Before(cutoff) ||
+			strings.HasPrefix(object.Key, scanner.QuarantinePrefix) ||
+			strings.HasPrefix(object.Key, images.VariantsDir) {
+			continue
+		}
+
+		// Listing does not return the content type
+		info, err := bucketRepo.StatObject(ctx, bucketName, object.Key)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to register legacy image", "object", object.Key, "error", err)
+			continue
+		}
+
+		// Keep the time of the upload, so the image stays older than the
+		// oldest media on the next run
+		media := &models.Media{
+			ObjectName:  object.Key,
+			ContentType: info.ContentType,
+			Size:        info.Size,
+			Status:      models.MediaStatusPending,
+		}
+		media.CreatedAt = object.LastModified
+		if err := mediaRepo.CreateMedia(ctx, media); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "registered legacy image", "object", object.Key, "bytes", info.Size)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aliftoriq/go-crud/repositories"
+)
+
+const backfillBatchSize = 100
+
+// BackfillMediaSizes records the size of media uploaded before sizes were
+// stored, so they count towards the storage quota of their owner.
+func BackfillMediaSizes(ctx context.Context, mediaRepo repositories.MediaRepository, bucketRepo repositories.BucketRepository, bucketName string) error {
+	var lastID uint
+	for {
+		media, err := mediaRepo.GetMediaWithoutSize(ctx, lastID, backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(*media) == 0 {
+			return nil
+		}
+
+		for i := range *media {
+			m := &(*media)[i]
+			lastID = m.ID
+
+			info, err := bucketRepo.StatObject(ctx, bucketName, m.ObjectName)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to get size of media", "object", m.ObjectName, "error", err)
+				continue
+			}
+			if err := mediaRepo.SetSize(ctx, m, info.Size); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aliftoriq/go-crud/images"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+)
+
+// OrphanOptions configures CollectOrphans.
+type OrphanOptions struct {
+	// GracePeriod protects recently written objects from deletion. Younger
+	// objects may belong to an upload that is not completed yet.
+	GracePeriod time.Duration
+	// Delete removes unreferenced objects older than GracePeriod. Without it
+	// orphans are only reported.
+	Delete bool
+}
+
+// OrphanReport is the result of CollectOrphans.
+type OrphanReport struct {
+	// Objects is the number of objects in the bucket.
+	Objects int
+	// Unreferenced are objects no media refers to, including variants of
+	// images that no longer exist.
+	Unreferenced []repositories.ObjectInfo
+	// Missing are object names of media whose object is not in the bucket.
+	Missing []string
+	// Deleted are the unreferenced objects that were deleted.
+	Deleted []string
+}
+
+// CollectOrphans compares the objects in the bucket with the media in the
+// database and reports orphans in both directions. With opts.Delete it also
+// deletes unreferenced objects older than the grace period. Media without an
+// object are only reported, as they need a decision about the articles that
+// show them.
+func CollectOrphans(ctx context.Context, mediaRepo repositories.MediaRepository, bucketRepo repositories.BucketRepository, bucketName string, opts OrphanOptions) (OrphanReport, error) {
+	var report OrphanReport
+
+	// Read the database before listing the bucket: an upload completing in
+	// between then shows up as an unreferenced object, which the grace period
+	// protects, instead of as media without an object.
+	names, err := mediaRepo.GetAllObjectNames(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	objects, err := bucketRepo.ListObjects(ctx, bucketName, "")
+	if err != nil {
+		return report, err
+	}
+	report.Objects = len(objects)
+
+	referenced := make(map[string]bool, len(names))
+	for _, name := range names {
+		referenced[name] = true
+	}
+
+	stored := make(map[string]bool, len(objects))
+	cutoff := time.Now().Add(-opts.GracePeriod)
+	for _, object := range objects {
+		stored[object.Key] = true
+		// Media of an upload that is still being scanned has only the
+		// quarantined object
+		if strings.HasPrefix(object.Key, scanner.QuarantinePrefix) {
+			stored[strings.TrimPrefix(object.Key, scanner.QuarantinePrefix)] = true
+		}
+
+		if referenced[originalObject(object.Key)] {
+			continue
+		}
+		report.Unreferenced = append(report.Unreferenced, object)
+
+		if !opts.Delete || object.LastModified.After(cutoff) {
+			continue
+		}
+		if err := bucketRepo.DeleteObject(ctx, bucketName, object.Key); err != nil {
+			return report, err
+		}
+		report.Deleted = append(report.Deleted, object.Key)
+	}
+
+	for _, name := range names {
+		if !stored[name] {
+			report.Missing = append(report.Missing, name)
+		}
+	}
+
+	return report, nil
+}
+
+// originalObject returns the name of the image a variant was generated from
+// or a quarantined upload will be stored under, or the key itself if it is
+// neither.
+func originalObject(key string) string {
+	if strings.HasPrefix(key, scanner.QuarantinePrefix) {
+		return strings.TrimPrefix(key, scanner.QuarantinePrefix)
+	}
+	if !strings.HasPrefix(key, images.VariantsDir) {
+		return key
+	}
+	original, _, _ := strings.Cut(strings.TrimPrefix(key, images.VariantsDir), "/")
+	return original
+}
+
+// LogOrphanReport writes a report to the log, one line per orphan.
+func LogOrphanReport(report OrphanReport) {
+	deleted := make(map[string]bool, len(report.Deleted))
+	for _, key := range report.Deleted {
+		deleted[key] = true
+	}
+
+	for _, object := range report.Unreferenced {
+		action := "kept"
+		if deleted[object.Key] {
+			action = "deleted"
+		}
+		slog.Info("unreferenced object", "object", object.Key, "bytes", object.Size, "modified", object.LastModified, "action", action)
+	}
+	for _, name := range report.Missing {
+		slog.Warn("media has no object", "object", name)
+	}
+
+	slog.Info("checked objects",
+		"objects", report.Objects,
+		"unreferenced", len(report.Unreferenced),
+		"deleted", len(report.Deleted),
+		"missing", len(report.Missing))
+}
+
+// CollectOrphansJob returns CollectOrphans as a job for Every.
+func CollectOrphansJob(mediaRepo repositories.MediaRepository, bucketRepo repositories.BucketRepository, bucketName string, opts OrphanOptions) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		report, err := CollectOrphans(ctx, mediaRepo, bucketRepo, bucketName, opts)
+		if err != nil {
+			return err
+		}
+		LogOrphanReport(report)
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/scanner"
+)
+
+// pendingScanDelay keeps ScanPendingMedia away from uploads whose scan is
+// still running in the request that stored them.
+const pendingScanDelay = 5 * time.Minute
+
+// maxScanAttempts is the number of failed scans after which an upload is
+// failed instead of scanned again.
+const maxScanAttempts = 10
+
+// ScanPendingMedia returns a job for Every that scans again the uploads whose
+// scan failed when they were stored, and the images registered by
+// RegisterLegacyObjects. Clean uploads become available and infected ones are
+// deleted together with their media.
+func ScanPendingMedia(mediaRepo repositories.MediaRepository, bucketRepo repositories.BucketRepository, s scanner.Scanner, bucketName string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		media, err := mediaRepo.GetPendingMedia(ctx, time.Now().Add(-pendingScanDelay), backfillBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range *media {
+			m := &(*media)[i]
+
+			result, err := scanner.Admit(ctx, s, bucketRepo, bucketName, m.ObjectName)
+			if errors.Is(err, repositories.ErrObjectNotFound) {
+				// Nothing is in quarantine: the image was stored before
+				// uploads were scanned, or the upload was promoted but its
+				// status was not updated. Scan it where it is.
+				result, err = scanner.Check(ctx, s, bucketRepo, bucketName, m.ObjectName)
+			}
+			if errors.Is(err, repositories.ErrObjectNotFound) {
+				slog.WarnContext(ctx, "media has no object to scan", "object", m.ObjectName, "user_id", m.UserID)
+				if err := mediaRepo.SetStatus(ctx, m, models.MediaStatusFailed); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to scan media", "object", m.ObjectName, "attempt", m.ScanAttempts+1, "error", err)
+				if err := failScan(ctx, mediaRepo, m); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if !result.Clean {
+				slog.WarnContext(ctx, "media is infected", "object", m.ObjectName, "user_id", m.UserID, "threat", result.Threat)
+				if err := mediaRepo.DeleteMedia(ctx, m); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := mediaRepo.SetStatus(ctx, m, models.MediaStatusClean); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// failScan counts a failed scan of the media, failing it on the last attempt.
+func failScan(ctx context.Context, mediaRepo repositories.MediaRepository, media *models.Media) error {
+	if media.ScanAttempts+1 >= maxScanAttempts {
+		slog.WarnContext(ctx, "giving up scanning media", "object", media.ObjectName, "user_id", media.UserID)
+		return mediaRepo.SetStatus(ctx, media, models.MediaStatusFailed)
+	}
+	return mediaRepo.AddScanAttempt(ctx, media)
+}
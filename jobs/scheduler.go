@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Every runs fn once per interval until ctx is cancelled. A failed run is
+// logged and retried on the next tick.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run(ctx, name, fn)
+		}
+	}
+}
+
+// run runs fn in a span of its own, so the queries and calls of the job are
+// traced together.
+func run(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	ctx, span := otel.Tracer("github.com/aliftoriq/go-crud/jobs").Start(ctx, "job "+name)
+	defer span.End()
+
+	if err := fn(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "job failed", "job", name, "error", err)
+	}
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aliftoriq/go-crud/repositories"
+)
+
+// AbortStaleUploads returns a job that aborts multipart uploads started more
+// than maxAge ago, freeing the storage held by their parts.
+func AbortStaleUploads(bucketRepo repositories.BucketRepository, bucketName string, maxAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		uploads, err := bucketRepo.ListIncompleteUploads(ctx, bucketName)
+		if err != nil {
+			return err
+		}
+
+		cutoff := time.Now().Add(-maxAge)
+		aborted := 0
+		for _, upload := range uploads {
+			if upload.Initiated.After(cutoff) {
+				continue
+			}
+			if err := bucketRepo.AbortMultipartUpload(ctx, bucketName, upload.Key, upload.UploadID); err != nil {
+				return err
+			}
+			aborted++
+		}
+
+		if aborted > 0 {
+			slog.InfoContext(ctx, "aborted stale multipart uploads", "count", aborted)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+// Package lifecycle starts and stops the subsystems of the service in order.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Hook is a subsystem that is started and stopped with the service. Either
+// function may be nil.
+type Hook struct {
+	Name string
+	// OnStart must not block; long running work belongs in a goroutine that
+	// OnStop ends.
+	OnStart func(ctx context.Context) error
+	// OnStop should return once the subsystem has stopped or ctx is done.
+	OnStop func(ctx context.Context) error
+}
+
+// Lifecycle runs hooks in the order they were appended and stops them in
+// reverse, so a subsystem is stopped before the ones it depends on.
+type Lifecycle struct {
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+// Append adds a hook. Hooks appended after Start are not started.
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs the OnStart of every hook. When one fails, the hooks started
+// before it are stopped again and the error is returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				startErr := fmt.Errorf("start %s: %w", hook.Name, err)
+				if stopErr := l.stop(ctx); stopErr != nil {
+					slog.ErrorContext(ctx, "failed to stop after a failed start", "error", stopErr)
+				}
+				return startErr
+			}
+		}
+		l.started++
+	}
+	return nil
+}
+
+// Stop runs the OnStop of every started hook in reverse order. A failing hook
+// does not keep the others from stopping; all failures are returned together.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stop(ctx)
+}
+
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var failures []string
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if hook.OnStop == nil {
+			continue
+		}
+		if err := hook.OnStop(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("stop %s: %v", hook.Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Package logging sets up structured logging with log/slog and ties log lines
+// to the request they belong to.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/aliftoriq/go-crud/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a logger that writes records of at least the configured level
+// to w, as JSON or text. Records logged with the context of a request carry
+// its request ID, and the trace and span IDs when the request is traced.
+func New(cfg config.Log, w io.Writer) *slog.Logger {
+	// Checked by config.Validate; an invalid level logs at info
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(requestHandler{handler})
+}
+
+// requestHandler adds the request ID and the trace of the context to every
+// record.
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
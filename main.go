@@ -1,26 +1,24 @@
 package main
 
 import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
 	_ "github.com/aliftoriq/go-crud/docs"
 
-	"github.com/aliftoriq/go-crud/controllers"
+	"github.com/aliftoriq/go-crud/app"
+	"github.com/aliftoriq/go-crud/config"
 	"github.com/aliftoriq/go-crud/initializer"
-	"github.com/aliftoriq/go-crud/middleware"
-	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/logging"
+	"github.com/aliftoriq/go-crud/tracing"
 	"github.com/gin-gonic/gin"
-	swaggerfiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"github.com/minio/minio-go/v7"
 )
 
-func init() {
-	initializer.LoadEnvVariables()
-	initializer.ConnectToDb()
-	initializer.SyncDatabase()
-	initializer.ConnectToMinio()
-	initializer.ConnectToRedis()
-
-}
-
 // @title Tag Go Crud Service API
 // @version 1.0
 // @description A golang Restfull API
@@ -28,40 +26,85 @@ func init() {
 // @host localhost:4001
 
 func main() {
-	r := gin.Default()
-
-	middlewareAuth := middleware.NewAuth()
-
-	userRepo := repositories.NewUserRepository()
-	userController := controllers.NewUsersController(userRepo)
-
-	arRepo := repositories.NewArticleRepository()
-	cacheRepo := repositories.NewCacheRepository()
-	arController := controllers.NewArticlesController(arRepo, cacheRepo)
-
-	bucketRepo := repositories.NewBucketRepository()
-	bucketController := controllers.NewBucketControllers(bucketRepo)
-
-	// add swagger
-	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
-
-	r.POST("/signup", userController.Signup)
-	r.POST("/login", userController.Login)
-	r.GET("/validate", middlewareAuth.RequireAuth, userController.Validate)
-
-	r.GET("/users/:id", middlewareAuth.RequireAuth, userController.GetUser)
-	r.PUT("/users/:id", middlewareAuth.RequireAuth, userController.UpdateUser)
-	r.DELETE("/users/:id", middlewareAuth.RequireAuth, userController.DeleteUser)
-
-	r.POST("/articles", middlewareAuth.RequireAuth, arController.CreateArticle)
-	r.PUT("/articles/:id", middlewareAuth.RequireAuth, arController.UpdateArticle)
-	r.GET("/articles", middlewareAuth.RequireAuth, arController.GetArticles)
-	r.GET("/articles/:id", middlewareAuth.RequireAuth, arController.GetArticleByID)
-	r.DELETE("/articles/:id", middlewareAuth.RequireAuth, arController.DeleteArticle)
+	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfig(cfg, err, os.Args[2:])
+		return
+	}
+	if err != nil {
+		// Logging is not configured yet
+		log.Fatalln(err)
+	}
+	slog.SetDefault(logging.New(cfg.Log, os.Stdout))
+
+	gc := len(os.Args) > 1 && os.Args[1] == "gc"
+	if gc {
+		// Keep the route listing of debug mode out of the report
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	tracerProvider, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	deps, err := connect(cfg)
+	if err != nil {
+		fatal("failed to connect", err)
+	}
+	deps.Tracing = tracerProvider
+	application := app.New(cfg, deps)
+
+	if gc {
+		runGC(application, os.Args[2:])
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal kills the process without waiting for the drain
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := application.Run(ctx); err != nil {
+		fatal("failed to run", err)
+	}
+}
 
-	r.POST("/upload-image", middlewareAuth.RequireAuth, bucketController.UploadImageToMinio)
-	r.GET("/image/:id", middlewareAuth.RequireAuth, bucketController.GetImage)
-	r.DELETE("/image/:id", middlewareAuth.RequireAuth, bucketController.DeleteImage)
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	r.Run()
+// connect opens the clients of the configured services.
+func connect(cfg *config.Config) (app.Deps, error) {
+	db, err := initializer.ConnectToDb(cfg.Database.DSN)
+	if err != nil {
+		return app.Deps{}, err
+	}
+	if err := initializer.SyncDatabase(db); err != nil {
+		return app.Deps{}, err
+	}
+
+	var minioClient *minio.Client
+	if cfg.Storage.Backend == "minio" {
+		minioClient, err = initializer.ConnectToMinio(cfg.Minio)
+		if err != nil {
+			return app.Deps{}, err
+		}
+	}
+
+	redisClient, err := initializer.ConnectToRedis(cfg.Redis)
+	if err != nil {
+		return app.Deps{}, err
+	}
+
+	return app.Deps{
+		DB:    db,
+		Redis: redisClient,
+		Minio: minioClient,
+	}, nil
 }
@@ -0,0 +1,81 @@
+// Package metrics exposes Prometheus metrics of the service on /metrics.
+//
+// The collectors are registered with the default registry, which also
+// reports the Go runtime and process metrics. Labels only take values from a
+// small set, like route templates instead of request paths, so the number of
+// series stays bounded.
+package metrics
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time spent handling HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookups_total",
+		Help: "Cache lookups by cache and result, hit or miss.",
+	}, []string{"cache", "result"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time spent in database queries made through GORM.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table", "status"})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "storage_operation_duration_seconds",
+		Help:    "Time spent in object storage operations.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend", "operation", "status"})
+
+	storageBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "storage_bytes_total",
+		Help: "Bytes sent to and received from object storage.",
+	}, []string{"backend", "direction"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// CacheLookup counts a lookup in the named cache.
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+func status(err error) string {
+	if err != nil {
+		return statusError
+	}
+	return statusOK
+}
+
+func since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type instrumentedBucket struct {
+	backend string
+	next    repositories.BucketRepository
+}
+
+// InstrumentBucket times the operations of a bucket repository and counts the
+// bytes it sends and receives, labelled with the name of its backend.
+func InstrumentBucket(backend string, next repositories.BucketRepository) repositories.BucketRepository {
+	return &instrumentedBucket{backend: backend, next: next}
+}
+
+func (b *instrumentedBucket) observe(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(b.backend, operation, status(err)).Observe(since(start))
+}
+
+// sent counts the size of an upload once it succeeded. The reader itself is
+// passed on untouched, so backends can still seek it to retry.
+func (b *instrumentedBucket) sent(size int64, err error) {
+	if err == nil && size > 0 {
+		storageBytes.WithLabelValues(b.backend, "sent").Add(float64(size))
+	}
+}
+
+func (b *instrumentedBucket) PutObject(ctx context.Context, bName string, oName string, file io.Reader, fileSize int64, contentType string) error {
+	start := time.Now()
+	err := b.next.PutObject(ctx, bName, oName, file, fileSize, contentType)
+	b.observe("put_object", start, err)
+	b.sent(fileSize, err)
+	return err
+}
+
+// GetObject only times opening the object; the bytes are counted as the
+// object is read.
+func (b *instrumentedBucket) GetObject(ctx context.Context, bName string, oName string) (io.ReadSeekCloser, error) {
+	start := time.Now()
+	object, err := b.next.GetObject(ctx, bName, oName)
+	b.observe("get_object", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return countedObject{ReadSeekCloser: object, counter: storageBytes.WithLabelValues(b.backend, "received")}, nil
+}
+
+func (b *instrumentedBucket) StatObject(ctx context.Context, bName string, oName string) (repositories.ObjectInfo, error) {
+	start := time.Now()
+	info, err := b.next.StatObject(ctx, bName, oName)
+	// A missing object is an answer, not a failure of the storage
+	if err == repositories.ErrObjectNotFound {
+		b.observe("stat_object", start, nil)
+	} else {
+		b.observe("stat_object", start, err)
+	}
+	return info, err
+}
+
+func (b *instrumentedBucket) ListObjects(ctx context.Context, bName string, prefix string) ([]repositories.ObjectInfo, error) {
+	start := time.Now()
+	objects, err := b.next.ListObjects(ctx, bName, prefix)
+	b.observe("list_objects", start, err)
+	return objects, err
+}
+
+func (b *instrumentedBucket) DeleteObject(ctx context.Context, bName string, oName string) error {
+	start := time.Now()
+	err := b.next.DeleteObject(ctx, bName, oName)
+	b.observe("delete_object", start, err)
+	return err
+}
+
+func (b *instrumentedBucket) PresignPutObject(ctx context.Context, bName string, oName string, expiry time.Duration, contentType string, size int64) (string, error) {
+	start := time.Now()
+	url, err := b.next.PresignPutObject(ctx, bName, oName, expiry, contentType, size)
+	b.observe("presign_put_object", start, err)
+	return url, err
+}
+
+func (b *instrumentedBucket) PresignGetObject(ctx context.Context, bName string, oName string, expiry time.Duration) (string, error) {
+	start := time.Now()
+	url, err := b.next.PresignGetObject(ctx, bName, oName, expiry)
+	b.observe("presign_get_object", start, err)
+	return url, err
+}
+
+func (b *instrumentedBucket) NewMultipartUpload(ctx context.Context, bName string, oName string, contentType string) (string, error) {
+	start := time.Now()
+	uploadID, err := b.next.NewMultipartUpload(ctx, bName, oName, contentType)
+	b.observe("new_multipart_upload", start, err)
+	return uploadID, err
+}
+
+func (b *instrumentedBucket) PutObjectPart(ctx context.Context, bName string, oName string, uploadID string, partNumber int, data io.Reader, size int64) (repositories.ObjectPart, error) {
+	start := time.Now()
+	part, err := b.next.PutObjectPart(ctx, bName, oName, uploadID, partNumber, data, size)
+	b.observe("put_object_part", start, err)
+	b.sent(size, err)
+	return part, err
+}
+
+func (b *instrumentedBucket) ListObjectParts(ctx context.Context, bName string, oName string, uploadID string) ([]repositories.ObjectPart, error) {
+	start := time.Now()
+	parts, err := b.next.ListObjectParts(ctx, bName, oName, uploadID)
+	b.observe("list_object_parts", start, err)
+	return parts, err
+}
+
+func (b *instrumentedBucket) CompleteMultipartUpload(ctx context.Context, bName string, oName string, uploadID string, parts []repositories.ObjectPart) error {
+	start := time.Now()
+	err := b.next.CompleteMultipartUpload(ctx, bName, oName, uploadID, parts)
+	b.observe("complete_multipart_upload", start, err)
+	return err
+}
+
+func (b *instrumentedBucket) AbortMultipartUpload(ctx context.Context, bName string, oName string, uploadID string) error {
+	start := time.Now()
+	err := b.next.AbortMultipartUpload(ctx, bName, oName, uploadID)
+	b.observe("abort_multipart_upload", start, err)
+	return err
+}
+
+func (b *instrumentedBucket) ListIncompleteUploads(ctx context.Context, bName string) ([]repositories.IncompleteUpload, error) {
+	start := time.Now()
+	uploads, err := b.next.ListIncompleteUploads(ctx, bName)
+	b.observe("list_incomplete_uploads", start, err)
+	return uploads, err
+}
+
+// countedObject counts the bytes read from an object.
+type countedObject struct {
+	io.ReadSeekCloser
+	counter prometheus.Counter
+}
+
+func (o countedObject) Read(p []byte) (int, error) {
+	n, err := o.ReadSeekCloser.Read(p)
+	o.counter.Add(float64(n))
+	return n, err
+}
@@ -1,16 +1,16 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
-	"net/http"
-	"os"
+	"log/slog"
+	"strconv"
 	"time"
 
-	"github.com/aliftoriq/go-crud/initializer"
-	"github.com/aliftoriq/go-crud/models"
+	"github.com/aliftoriq/go-crud/problem"
+	"github.com/aliftoriq/go-crud/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"gorm.io/gorm"
 )
 
 type Auth interface {
@@ -18,45 +18,60 @@ type Auth interface {
 }
 
 type auth struct {
-	db *gorm.DB
+	userRepo repositories.UserRepository
+	secret   []byte
 }
 
-func NewAuth() Auth {
-	return &auth{db: initializer.DB}
+func NewAuth(userRepo repositories.UserRepository, secret string) Auth {
+	return &auth{userRepo: userRepo, secret: []byte(secret)}
 }
 
+// RequireAuth stores the user of the token in the Authorization cookie on
+// the context, and rejects the request when there is no valid token.
 func (a *auth) RequireAuth(c *gin.Context) {
 	tokenString, err := c.Cookie("Authorization")
-
 	if err != nil {
-		c.AbortWithStatus(http.StatusUnauthorized)
+		problem.Abort(c, problem.ErrUnauthorized)
+		return
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("UNEXPECTED SIGN IN METHOD: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("SECRET")), nil
+		return a.secret, nil
 	})
+	if err != nil || !token.Valid {
+		slog.DebugContext(c, "invalid token", "error", err)
+		problem.Abort(c, problem.ErrUnauthorized)
+		return
+	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Check the exp token
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		problem.Abort(c, problem.ErrUnauthorized)
+		return
+	}
 
-		// Find the user with token sub
-		var user models.User
-		a.db.First(&user, claims["sub"])
+	// Check the exp token
+	if exp, _ := claims["exp"].(float64); float64(time.Now().Unix()) > exp {
+		problem.Abort(c, problem.ErrUnauthorized)
+		return
+	}
 
-		if user.ID == 0 {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
+	// Find the user with token sub
+	sub, _ := claims["sub"].(float64)
+	user, err := a.userRepo.FindByID(c, strconv.FormatFloat(sub, 'f', -1, 64))
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		problem.Abort(c, problem.ErrUnauthorized)
+		return
+	}
+	if err != nil {
+		problem.Abort(c, err)
+		return
+	}
 
-		c.Set("user", user)
+	c.Set("user", *user)
 
-		c.Next()
-	} else {
-		fmt.Println(err)
-	}
+	c.Next()
 }
@@ -8,11 +8,23 @@ import (
 
 type Article struct {
 	gorm.Model
-	ID        int
-	Email     string         `json:"email"`
-	Title     string         `json:"title"`
-	Content   string         `json:"content"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	ID int
+	// UserID is the author. Email is the email of the author when the
+	// article was written.
+	UserID        int              `json:"user_id" gorm:"index"`
+	Email         string           `json:"email"`
+	Title         string           `json:"title"`
+	Content       string           `json:"content"`
+	ContentFormat string           `json:"content_format" gorm:"default:plain"`
+	ContentHTML   string           `json:"content_html"`
+	Excerpt       string           `json:"excerpt"`
+	ReadingTime   int              `json:"reading_time"`
+	CoverImage    string           `json:"cover_image"`
+	CommentCount  int64            `json:"comment_count" gorm:"-"`
+	Reactions     map[string]int64 `json:"reactions" gorm:"-"`
+	BookmarkCount int64            `json:"bookmark_count" gorm:"-"`
+	ViewCount     int64            `json:"view_count" gorm:"-"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt   `gorm:"index" json:"deleted_at"`
 }
@@ -0,0 +1,9 @@
+package models
+
+// ArticleCounter holds the persisted value of one engagement counter of an
+// article, e.g. "bookmarks" or "reaction:like".
+type ArticleCounter struct {
+	ArticleID int    `json:"article_id" gorm:"primaryKey"`
+	Name      string `json:"name" gorm:"primaryKey"`
+	Value     int64  `json:"value"`
+}
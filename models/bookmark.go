@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type Bookmark struct {
+	UserID    int       `json:"user_id" gorm:"primaryKey"`
+	ArticleID int       `json:"article_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+type Comment struct {
+	gorm.Model
+	ArticleID int       `json:"article_id" gorm:"index"`
+	UserID    int       `json:"user_id" gorm:"index"`
+	ParentID  *uint     `json:"parent_id" gorm:"index"`
+	RootID    *uint     `json:"root_id" gorm:"index"`
+	Content   string    `json:"content"`
+	Replies   []Comment `json:"replies,omitempty" gorm:"-"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "gorm.io/gorm"
+
+type Media struct {
+	gorm.Model
+	ObjectName  string `json:"object_name" gorm:"uniqueIndex"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// VariantsSize is the size of the variants generated from the image, which
+	// count toward the quota of its user too.
+	VariantsSize int64  `json:"variants_size" gorm:"not null;default:0"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Format       string `json:"format"`
+	// Status is pending until the upload was scanned clean. Only clean media
+	// is served, so media whose status was not set is pending too.
+	Status string `json:"status" gorm:"default:pending;index"`
+	// ScanAttempts counts the failed scans of a pending upload. It is failed
+	// after too many of them.
+	ScanAttempts int  `json:"-" gorm:"not null;default:0"`
+	UserID       int  `json:"user_id" gorm:"index"`
+	ArticleID    *int `json:"article_id" gorm:"index"`
+}
+
+const (
+	MediaStatusPending = "pending"
+	MediaStatusClean   = "clean"
+	// MediaStatusFailed is an upload that could not be scanned, e.g. because
+	// its object is gone. It is never served.
+	MediaStatusFailed = "failed"
+)
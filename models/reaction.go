@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type Reaction struct {
+	UserID    int       `json:"user_id" gorm:"primaryKey"`
+	ArticleID int       `json:"article_id" gorm:"primaryKey;index"`
+	Type      string    `json:"type" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -8,4 +8,13 @@ type User struct {
 	Name     string `json:"name"`
 	Email    string `json:"email" gorm:"unique"`
 	Password string `json:"password"`
+	Role     string `json:"role" gorm:"default:user"`
+	// StorageQuota overrides the storage quota of the role, in bytes.
+	StorageQuota *int64 `json:"storage_quota"`
 }
+
+const (
+	RoleUser = "user"
+	// RoleAdmin can delete media of any user.
+	RoleAdmin = "admin"
+)
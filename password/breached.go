@@ -0,0 +1,66 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Breached looks passwords up in a local copy of the Pwned Passwords range
+// files, so no password or hash leaves the service. The files are laid out
+// like the k-anonymity API serves them: each is named by a hash prefix, the
+// first five hex digits of SHA-1 hashes in upper case, with or without .txt,
+// and lists the remaining 35 digits of each hash with its count, one per
+// line:
+//
+//	0018A45C4D1DEF81644B54AB7F969B88D65:10
+//
+// Only the file of the prefix of a password is read, so the copy can hold
+// all known passwords. Prefixes without a file have no breached passwords.
+type Breached struct {
+	Dir string
+}
+
+// Contains reports whether password is in a breach.
+func (b *Breached) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := b.open(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding lines, which the API adds to hide the size of a range,
+		// have a count of 0
+		if strings.EqualFold(line, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("password: breached range %s: %w", prefix, err)
+	}
+	return false, nil
+}
+
+func (b *Breached) open(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(b.Dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	}
+	return f, err
+}
@@ -0,0 +1,128 @@
+// Package password checks new passwords against a policy and hashes them.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The algorithms a Hasher can hash with.
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	// ErrMismatch is returned by Verify when the password is wrong.
+	ErrMismatch = errors.New("password: does not match the hash")
+	// ErrUnknownHash is returned by Verify for hashes it cannot read.
+	ErrUnknownHash = errors.New("password: unknown hash format")
+)
+
+// Hasher hashes passwords with one algorithm and its parameters, and
+// verifies hashes made with any of them.
+type Hasher struct {
+	// Algorithm is Bcrypt or Argon2id.
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// Argon2Params are the parameters of argon2id.
+type Argon2Params struct {
+	Time uint32
+	// Memory is in KiB.
+	Memory  uint32
+	Threads uint8
+}
+
+// Hash returns the hash of password in the modular crypt format, which
+// records the algorithm and its parameters.
+func (h Hasher) Hash(password string) (string, error) {
+	if h.Algorithm == Argon2id {
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Time, h.Argon2.Memory, h.Argon2.Threads, argon2KeyLength)
+		return encodeArgon2(h.Argon2, salt, key), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	return string(hash), err
+}
+
+// Verify checks password against hash. It returns ErrMismatch when the
+// password is wrong, and rehash when it is right but the hash was made with
+// another algorithm or other parameters, so it should be replaced by Hash.
+func (h Hasher) Verify(hash string, password string) (rehash bool, err error) {
+	if strings.HasPrefix(hash, "$"+Argon2id+"$") {
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, ErrMismatch
+		}
+		return h.Algorithm != Argon2id || params != h.Argon2, nil
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, ErrUnknownHash
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+	return h.Algorithm != Bcrypt || cost != h.BcryptCost, nil
+}
+
+// encodeArgon2 formats an argon2id hash like the reference implementation:
+// $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func encodeArgon2(params Argon2Params, salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2id, argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (params Argon2Params, salt []byte, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,118 @@
+package password
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the most bytes a password may have. bcrypt ignores the rest,
+// and passwords are held to it whatever the algorithm so they keep working
+// when the algorithm changes.
+const MaxLength = 72
+
+// Policy decides which new passwords are accepted.
+type Policy struct {
+	// MinLength is in characters.
+	MinLength int
+	// MinEntropy is the least strength Entropy may estimate, in bits; 0
+	// turns the estimate off.
+	MinEntropy float64
+	// Breached rejects passwords known from breaches; nil turns the check
+	// off.
+	Breached *Breached
+}
+
+// Weakness is why a Policy rejects a password.
+type Weakness struct {
+	// Rule is min, max, entropy or breached.
+	Rule string
+	// Message completes "password ...".
+	Message string
+}
+
+func (w *Weakness) Error() string {
+	return "password " + w.Message
+}
+
+// Check returns a *Weakness when the policy rejects password, or an error
+// when the list of breached passwords could not be read.
+func (p Policy) Check(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &Weakness{Rule: "min", Message: fmt.Sprintf("must be at least %d characters", p.MinLength)}
+	}
+	if len(password) > MaxLength {
+		return &Weakness{Rule: "max", Message: fmt.Sprintf("must be at most %d bytes", MaxLength)}
+	}
+	if p.MinEntropy > 0 && Entropy(password) < p.MinEntropy {
+		return &Weakness{Rule: "entropy", Message: "is too easy to guess, use a longer or less predictable one"}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return &Weakness{Rule: "breached", Message: "appears in a known data breach, choose another one"}
+		}
+	}
+	return nil
+}
+
+// Entropy estimates the strength of password in bits. Each character counts
+// for the size of the character classes the password draws from, except
+// characters that repeat the previous one or continue a sequence like abc or
+// 321, which count for a single bit. It is a rough estimate that only keeps
+// out the most predictable passwords; dictionary words are left to the list
+// of breached passwords.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	var bits float64
+	var prev, step rune
+	for i, r := range password {
+		predictable := false
+		if i > 0 {
+			diff := r - prev
+			predictable = diff == 0 || (diff == 1 || diff == -1) && (step == 0 || step == diff)
+			step = diff
+		}
+		if predictable {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
@@ -0,0 +1,47 @@
+package problem
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aliftoriq/go-crud/repositories"
+)
+
+// domainErrors maps the errors of the repositories to problems. The first
+// match wins, so the kinds come last as fallbacks.
+var domainErrors = []struct {
+	err     error
+	problem *Problem
+}{
+	{repositories.ErrArticleNotFound, New(http.StatusNotFound, "article_not_found", "Article not found")},
+	{repositories.ErrCommentNotFound, New(http.StatusNotFound, "comment_not_found", "Comment not found")},
+	{repositories.ErrParentCommentNotFound, New(http.StatusNotFound, "parent_comment_not_found", "The comment replied to was not found")},
+	{repositories.ErrMediaNotFound, New(http.StatusNotFound, "media_not_found", "Media not found")},
+	{repositories.ErrUserNotFound, New(http.StatusNotFound, "user_not_found", "User not found")},
+	{repositories.ErrObjectNotFound, New(http.StatusNotFound, "image_not_found", "Image not found")},
+	{repositories.ErrUploadNotFound, New(http.StatusNotFound, "upload_not_found", "Upload not found or expired")},
+	{repositories.ErrInvalidObjectName, New(http.StatusBadRequest, "invalid_object_name", "Object name is not valid")},
+	{repositories.ErrEmailTaken, New(http.StatusConflict, "email_taken", "User with this email already exists")},
+	{repositories.ErrPresignNotSupported, New(http.StatusNotImplemented, "presign_not_supported", "Presigned URLs are not supported by this storage backend")},
+
+	{repositories.ErrNotFound, New(http.StatusNotFound, "not_found", "Not found")},
+	{repositories.ErrConflict, New(http.StatusConflict, "conflict", "The request conflicts with the current state")},
+	{repositories.ErrInvalid, New(http.StatusBadRequest, "invalid_request", "The request is not valid")},
+}
+
+// From returns the problem that describes err: err itself if it is a
+// problem, the problem of a known error of the repositories, or else
+// ErrInternal.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	for _, known := range domainErrors {
+		if errors.Is(err, known.err) {
+			return known.problem
+		}
+	}
+	return ErrInternal
+}
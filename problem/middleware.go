@@ -0,0 +1,43 @@
+package problem
+
+import (
+	"github.com/aliftoriq/go-crud/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware answers requests whose handlers reported an error with c.Error,
+// and wrote nothing, with the problem that describes the last error. The
+// errors themselves are logged by logging.Middleware.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil || c.Writer.Written() {
+			return
+		}
+		Write(c, From(last.Err))
+	}
+}
+
+// Abort reports err and stops the handlers after the current one, for
+// middleware that rejects a request.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// NoRoute answers requests that match no route.
+func NoRoute(c *gin.Context) {
+	c.Error(ErrRouteNotFound)
+}
+
+// Write answers the request with p, filling in the request path and ID.
+func Write(c *gin.Context, p *Problem) {
+	response := *p
+	response.Instance = c.Request.URL.Path
+	response.RequestID = logging.RequestID(c)
+
+	c.Header("Content-Type", ContentType)
+	c.JSON(response.Status, response)
+}
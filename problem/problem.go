@@ -0,0 +1,86 @@
+// Package problem answers failed requests with RFC 7807 problem details.
+//
+// Handlers report failures with c.Error and return; Middleware turns the
+// error into the response. Errors of the repositories are mapped to a
+// status and a stable code by From, and anything unknown becomes an internal
+// error whose details are only logged.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// Problem is a problem details object. It is an error too, so handlers can
+// report it with c.Error.
+type Problem struct {
+	// Type is about:blank: problems are told apart by Code.
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"Article not found"`
+	// Instance is the path of the request.
+	Instance string `json:"instance,omitempty" example:"/articles/42"`
+	// Code identifies the problem and never changes, unlike Detail.
+	Code      string `json:"code" example:"article_not_found"`
+	RequestID string `json:"request_id,omitempty"`
+	// Extensions are further members of the object, like the missing parts
+	// of an upload. They must not reuse the names above.
+	Extensions map[string]any `json:"-"`
+}
+
+// New returns a problem with the status, a stable code like
+// article_not_found and a detail for humans.
+func New(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Common problems that are not specific to a route.
+var (
+	ErrInternal      = New(http.StatusInternalServerError, "internal_error", "Something went wrong, try again later")
+	ErrUnauthorized  = New(http.StatusUnauthorized, "unauthorized", "Log in to continue")
+	ErrInvalidBody   = New(http.StatusBadRequest, "invalid_body", "The request body could not be read")
+	ErrRouteNotFound = New(http.StatusNotFound, "route_not_found", "No route matches the request")
+)
+
+func (p *Problem) Error() string {
+	return p.Code + ": " + p.Detail
+}
+
+// With returns a copy of the problem with an extension member added. Problems
+// are shared, so they are never changed in place.
+func (p *Problem) With(key string, value any) *Problem {
+	copied := *p
+	copied.Extensions = make(map[string]any, len(p.Extensions)+1)
+	for k, v := range p.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return &copied
+}
+
+// MarshalJSON writes the extensions next to the standard members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	// members has the fields of Problem without its methods
+	type members Problem
+	data, err := json.Marshal(members(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+
+	extensions, err := json.Marshal(p.Extensions)
+	if err != nil {
+		return nil, err
+	}
+	data[len(data)-1] = ','
+	return append(data, extensions[1:]...), nil
+}
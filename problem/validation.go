@@ -0,0 +1,21 @@
+package problem
+
+import "net/http"
+
+// FieldError is one field of a request body that failed validation.
+type FieldError struct {
+	// Field is the JSON name of the field.
+	Field string `json:"field" example:"email"`
+	// Rule is the validation rule that failed, like required or email.
+	Rule    string `json:"rule" example:"email"`
+	Message string `json:"message" example:"email must be a valid email address"`
+}
+
+// ErrValidation is the problem of a request body that was read but whose
+// fields are invalid. Invalid lists the fields.
+var ErrValidation = New(http.StatusBadRequest, "validation_failed", "The request body has invalid fields")
+
+// Invalid returns ErrValidation with the invalid fields as its errors member.
+func Invalid(fields []FieldError) *Problem {
+	return ErrValidation.With("errors", fields)
+}
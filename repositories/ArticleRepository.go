@@ -1,81 +1,200 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 
-	"github.com/aliftoriq/go-crud/initializer"
 	"github.com/aliftoriq/go-crud/models"
 	"gorm.io/gorm"
 )
 
 //go:generate mockery --outpkg mocks --name ArticleRepository
 type ArticleRepository interface {
-	CreateArticle(article models.Article) error
-	GetArticles() (*[]models.Article, error)
-	GetArticleById(id string) (*models.Article, error)
-	UpdateArticle(id string, article models.Article) error
-	DeleteArticle(id string) error
+	CreateArticle(ctx context.Context, article models.Article) error
+	GetArticles(ctx context.Context) (*[]models.Article, error)
+	GetArticleById(ctx context.Context, id string) (*models.Article, error)
+	GetArticlesByIDs(ctx context.Context, ids []int) (*[]models.Article, error)
+	GetArticleByIdUnscoped(ctx context.Context, id string) (*models.Article, error)
+	UpdateArticle(ctx context.Context, id string, article models.Article) error
+	DeleteArticle(ctx context.Context, id string) error
+	PurgeArticle(ctx context.Context, id string) error
 }
 
 type articleRepository struct {
 	db *gorm.DB
 }
 
-func NewArticleRepository() ArticleRepository {
-	return &articleRepository{db: initializer.DB}
+func NewArticleRepository(db *gorm.DB) ArticleRepository {
+	return &articleRepository{db: db}
 }
 
-func (ar *articleRepository) CreateArticle(article models.Article) error {
-	return ar.db.Create(&article).Error
+func (ar *articleRepository) CreateArticle(ctx context.Context, article models.Article) error {
+	return ar.db.WithContext(ctx).Create(&article).Error
 }
 
-func (ar *articleRepository) GetArticles() (*[]models.Article, error) {
+func (ar *articleRepository) GetArticles(ctx context.Context) (*[]models.Article, error) {
 	var article []models.Article
-	art := ar.db.Find(&article)
+	art := ar.db.WithContext(ctx).Find(&article)
 
 	if art.Error != nil {
 		return nil, errors.New("FAILED TO GET ARTICLES")
 	}
 
+	if err := ar.fillCommentCounts(ctx, article); err != nil {
+		return nil, err
+	}
+
 	return &article, nil
 }
 
-func (ar *articleRepository) GetArticleById(id string) (*models.Article, error) {
+func (ar *articleRepository) GetArticleById(ctx context.Context, id string) (*models.Article, error) {
 	var article models.Article
-	art := ar.db.Find(&article, id)
+	if err := ar.db.WithContext(ctx).First(&article, id).Error; err != nil {
+		return nil, recordError(err, ErrArticleNotFound, "FAILED TO GET ARTICLE")
+	}
 
-	if art.Error != nil {
+	articles := []models.Article{article}
+	if err := ar.fillCommentCounts(ctx, articles); err != nil {
+		return nil, err
+	}
+
+	return &articles[0], nil
+}
+
+// GetArticlesByIDs returns the articles with the given IDs in the order of ids.
+// IDs without an article are skipped.
+func (ar *articleRepository) GetArticlesByIDs(ctx context.Context, ids []int) (*[]models.Article, error) {
+	var found []models.Article
+	if err := ar.db.WithContext(ctx).Find(&found, ids).Error; err != nil {
 		return nil, errors.New("FAILED TO GET ARTICLES")
 	}
 
+	byID := make(map[int]models.Article, len(found))
+	for _, article := range found {
+		byID[article.ID] = article
+	}
+
+	articles := make([]models.Article, 0, len(found))
+	for _, id := range ids {
+		if article, ok := byID[id]; ok {
+			articles = append(articles, article)
+		}
+	}
+
+	if err := ar.fillCommentCounts(ctx, articles); err != nil {
+		return nil, err
+	}
+
+	return &articles, nil
+}
+
+// GetArticleByIdUnscoped returns the article even if it was soft deleted.
+func (ar *articleRepository) GetArticleByIdUnscoped(ctx context.Context, id string) (*models.Article, error) {
+	var article models.Article
+	if err := ar.db.WithContext(ctx).Unscoped().First(&article, id).Error; err != nil {
+		return nil, recordError(err, ErrArticleNotFound, "FAILED TO GET ARTICLE")
+	}
+
 	return &article, nil
 }
 
-func (ar *articleRepository) UpdateArticle(id string, article models.Article) error {
+func (ar *articleRepository) UpdateArticle(ctx context.Context, id string, article models.Article) error {
 	var existingArticle models.Article
-	if err := ar.db.First(&existingArticle, id).Error; err != nil {
-		return errors.New("ARTICLE NOT FOUND")
+	if err := ar.db.WithContext(ctx).First(&existingArticle, id).Error; err != nil {
+		return recordError(err, ErrArticleNotFound, "FAILED TO UPDATE ARTICLE")
 	}
 
 	existingArticle.Title = article.Title
 	existingArticle.Content = article.Content
+	existingArticle.ContentFormat = article.ContentFormat
+	existingArticle.ContentHTML = article.ContentHTML
+	existingArticle.Excerpt = article.Excerpt
+	existingArticle.ReadingTime = article.ReadingTime
 
-	if err := ar.db.Save(&existingArticle).Error; err != nil {
+	if err := ar.db.WithContext(ctx).Save(&existingArticle).Error; err != nil {
 		return errors.New("FAILED TO UPDATE ARTICLE")
 	}
 
 	return nil
 }
 
-func (ar *articleRepository) DeleteArticle(id string) error {
+func (ar *articleRepository) DeleteArticle(ctx context.Context, id string) error {
 	var existingArticle models.Article
-	if err := ar.db.First(&existingArticle, id).Error; err != nil {
-		return errors.New("ARTICLE NOT FOUND")
+	if err := ar.db.WithContext(ctx).First(&existingArticle, id).Error; err != nil {
+		return recordError(err, ErrArticleNotFound, "FAILED TO DELETE ARTICLE")
 	}
 
-	if err := ar.db.Delete(&existingArticle).Error; err != nil {
+	if err := ar.db.WithContext(ctx).Delete(&existingArticle).Error; err != nil {
 		return errors.New("FAILED TO DELETE ARTICLE")
 	}
 
 	return nil
 }
+
+// PurgeArticle permanently deletes an article, including soft deleted ones,
+// together with its comments, reactions, bookmarks, counters and media rows.
+// The media objects themselves must be removed from the bucket by the caller,
+// once the purge succeeded.
+func (ar *articleRepository) PurgeArticle(ctx context.Context, id string) error {
+	existingArticle, err := ar.GetArticleByIdUnscoped(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return ar.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		dependents := []interface{}{
+			&models.Comment{},
+			&models.Reaction{},
+			&models.Bookmark{},
+			&models.ArticleCounter{},
+			&models.Media{},
+		}
+		for _, model := range dependents {
+			if err := tx.Unscoped().Where("article_id = ?", existingArticle.ID).Delete(model).Error; err != nil {
+				return errors.New("FAILED TO PURGE ARTICLE")
+			}
+		}
+
+		if err := tx.Unscoped().Delete(existingArticle).Error; err != nil {
+			return errors.New("FAILED TO PURGE ARTICLE")
+		}
+
+		return nil
+	})
+}
+
+// fillCommentCounts sets CommentCount on each article in place, replies included.
+func (ar *articleRepository) fillCommentCounts(ctx context.Context, articles []models.Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(articles))
+	for i, article := range articles {
+		ids[i] = article.ID
+	}
+
+	var rows []struct {
+		ArticleID int
+		Count     int64
+	}
+	err := ar.db.WithContext(ctx).Model(&models.Comment{}).
+		Select("article_id, count(*) as count").
+		Where("article_id IN ?", ids).
+		Group("article_id").
+		Scan(&rows).Error
+	if err != nil {
+		return errors.New("FAILED TO COUNT COMMENTS")
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ArticleID] = row.Count
+	}
+
+	for i := range articles {
+		articles[i].CommentCount = counts[articles[i].ID]
+	}
+
+	return nil
+}
@@ -5,49 +5,238 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
 
-	"github.com/aliftoriq/go-crud/initializer"
-	"github.com/gin-gonic/gin"
 	"github.com/minio/minio-go/v7"
 )
 
 //go:generate mockery --outpkg mocks --name BucketRepository
 type BucketRepository interface {
-	PutObject(c *gin.Context, bName string, oName string, file io.Reader, fileSize int64) error
-	GetObject(c *gin.Context, bName string, oName string) (io.Reader, error)
-	DeleteObject(c *gin.Context, bName string, oName string) error
+	PutObject(ctx context.Context, bName string, oName string, file io.Reader, fileSize int64, contentType string) error
+	GetObject(ctx context.Context, bName string, oName string) (io.ReadSeekCloser, error)
+	StatObject(ctx context.Context, bName string, oName string) (ObjectInfo, error)
+	ListObjects(ctx context.Context, bName string, prefix string) ([]ObjectInfo, error)
+	DeleteObject(ctx context.Context, bName string, oName string) error
+	PresignPutObject(ctx context.Context, bName string, oName string, expiry time.Duration, contentType string, size int64) (string, error)
+	PresignGetObject(ctx context.Context, bName string, oName string, expiry time.Duration) (string, error)
+	NewMultipartUpload(ctx context.Context, bName string, oName string, contentType string) (string, error)
+	PutObjectPart(ctx context.Context, bName string, oName string, uploadID string, partNumber int, data io.Reader, size int64) (ObjectPart, error)
+	ListObjectParts(ctx context.Context, bName string, oName string, uploadID string) ([]ObjectPart, error)
+	CompleteMultipartUpload(ctx context.Context, bName string, oName string, uploadID string, parts []ObjectPart) error
+	AbortMultipartUpload(ctx context.Context, bName string, oName string, uploadID string) error
+	ListIncompleteUploads(ctx context.Context, bName string) ([]IncompleteUpload, error)
+}
+
+var (
+	// ErrObjectNotFound is returned by StatObject when the object does not exist.
+	ErrObjectNotFound = fmt.Errorf("OBJECT %w", ErrNotFound)
+	// ErrUploadNotFound is returned for multipart uploads that do not exist or
+	// were already completed or aborted.
+	ErrUploadNotFound = fmt.Errorf("UPLOAD %w", ErrNotFound)
+	// ErrInvalidObjectName is returned by backends that store objects under
+	// paths for names that would leave the bucket, like "../x".
+	ErrInvalidObjectName = fmt.Errorf("%w OBJECT NAME", ErrInvalid)
+	// ErrPresignNotSupported is returned by backends that cannot be accessed
+	// directly by clients.
+	ErrPresignNotSupported = errors.New("PRESIGNED URLS ARE NOT SUPPORTED BY THIS STORAGE BACKEND")
+)
+
+// ObjectInfo describes a stored object without its content.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectPart is one uploaded part of a multipart upload.
+type ObjectPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+// IncompleteUpload is a multipart upload that was neither completed nor aborted.
+type IncompleteUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
 }
 
 type bucketRepository struct {
 	minio *minio.Client
 }
 
-func NewBucketRepository() BucketRepository {
-	return &bucketRepository{minio: initializer.Client}
+func NewBucketRepository(client *minio.Client) BucketRepository {
+	return &bucketRepository{minio: client}
 }
 
-func (br *bucketRepository) PutObject(c *gin.Context, bName string, oName string, file io.Reader, fileSize int64) error {
-	_, err := br.minio.PutObject(context.Background(), bName, oName, file, fileSize, minio.PutObjectOptions{ContentType: "img/png"})
+func (br *bucketRepository) PutObject(ctx context.Context, bName string, oName string, file io.Reader, fileSize int64, contentType string) error {
+	_, err := br.minio.PutObject(ctx, bName, oName, file, fileSize, minio.PutObjectOptions{ContentType: contentType})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (br *bucketRepository) GetObject(c *gin.Context, bName string, oName string) (io.Reader, error) {
-	image, err := br.minio.GetObject(c, bName, oName, minio.GetObjectOptions{})
+// GetObject opens the object for reading. The object is only fetched when it is
+// first read, and seeking fetches from the new offset, so serving a range does
+// not download the whole object.
+func (br *bucketRepository) GetObject(ctx context.Context, bName string, oName string) (io.ReadSeekCloser, error) {
+	image, err := br.minio.GetObject(ctx, bName, oName, minio.GetObjectOptions{})
 
 	if err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(ctx, "failed to get object", "object", oName, "error", err)
 		return nil, errors.New("FAILED TO GET OBJECT")
 	}
 	return image, nil
 }
 
-func (br *bucketRepository) DeleteObject(c *gin.Context, bName string, oName string) error {
-	err := br.minio.RemoveObject(c, bName, oName, minio.RemoveObjectOptions{})
+func (br *bucketRepository) StatObject(ctx context.Context, bName string, oName string) (ObjectInfo, error) {
+	info, err := br.minio.StatObject(ctx, bName, oName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, errors.New("FAILED TO STAT OBJECT")
+	}
+
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (br *bucketRepository) ListObjects(ctx context.Context, bName string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range br.minio.ListObjects(ctx, bName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, errors.New("FAILED TO LIST OBJECTS")
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          info.Key,
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+func (br *bucketRepository) DeleteObject(ctx context.Context, bName string, oName string) error {
+	err := br.minio.RemoveObject(ctx, bName, oName, minio.RemoveObjectOptions{})
 	if err != nil {
 		return errors.New("FAILED TO DELETE OBJECT")
 	}
 	return nil
 }
+
+// PresignPutObject returns a URL that uploads the object directly to the
+// bucket. The Content-Type and Content-Length headers are part of the
+// signature, so the upload must use exactly the given type and size.
+func (br *bucketRepository) PresignPutObject(ctx context.Context, bName string, oName string, expiry time.Duration, contentType string, size int64) (string, error) {
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	u, err := br.minio.PresignHeader(ctx, http.MethodPut, bName, oName, expiry, nil, headers)
+	if err != nil {
+		return "", errors.New("FAILED TO PRESIGN UPLOAD")
+	}
+	return u.String(), nil
+}
+
+func (br *bucketRepository) PresignGetObject(ctx context.Context, bName string, oName string, expiry time.Duration) (string, error) {
+	u, err := br.minio.PresignedGetObject(ctx, bName, oName, expiry, nil)
+	if err != nil {
+		return "", errors.New("FAILED TO PRESIGN DOWNLOAD")
+	}
+	return u.String(), nil
+}
+
+func (br *bucketRepository) core() *minio.Core {
+	return &minio.Core{Client: br.minio}
+}
+
+func (br *bucketRepository) NewMultipartUpload(ctx context.Context, bName string, oName string, contentType string) (string, error) {
+	uploadID, err := br.core().NewMultipartUpload(ctx, bName, oName, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", errors.New("FAILED TO START UPLOAD")
+	}
+	return uploadID, nil
+}
+
+func (br *bucketRepository) PutObjectPart(ctx context.Context, bName string, oName string, uploadID string, partNumber int, data io.Reader, size int64) (ObjectPart, error) {
+	part, err := br.core().PutObjectPart(ctx, bName, oName, uploadID, partNumber, data, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return ObjectPart{}, uploadError(err, "FAILED TO UPLOAD PART")
+	}
+	return ObjectPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (br *bucketRepository) ListObjectParts(ctx context.Context, bName string, oName string, uploadID string) ([]ObjectPart, error) {
+	var parts []ObjectPart
+	marker := 0
+	for {
+		result, err := br.core().ListObjectParts(ctx, bName, oName, uploadID, marker, 1000)
+		if err != nil {
+			return nil, uploadError(err, "FAILED TO LIST PARTS")
+		}
+
+		for _, part := range result.ObjectParts {
+			parts = append(parts, ObjectPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size})
+		}
+
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (br *bucketRepository) CompleteMultipartUpload(ctx context.Context, bName string, oName string, uploadID string, parts []ObjectPart) error {
+	completeParts := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag}
+	}
+
+	if _, err := br.core().CompleteMultipartUpload(ctx, bName, oName, uploadID, completeParts, minio.PutObjectOptions{}); err != nil {
+		return uploadError(err, "FAILED TO COMPLETE UPLOAD")
+	}
+	return nil
+}
+
+func (br *bucketRepository) AbortMultipartUpload(ctx context.Context, bName string, oName string, uploadID string) error {
+	if err := br.core().AbortMultipartUpload(ctx, bName, oName, uploadID); err != nil {
+		return uploadError(err, "FAILED TO ABORT UPLOAD")
+	}
+	return nil
+}
+
+func (br *bucketRepository) ListIncompleteUploads(ctx context.Context, bName string) ([]IncompleteUpload, error) {
+	var uploads []IncompleteUpload
+	for info := range br.minio.ListIncompleteUploads(ctx, bName, "", true) {
+		if info.Err != nil {
+			return nil, errors.New("FAILED TO LIST UPLOADS")
+		}
+		uploads = append(uploads, IncompleteUpload{Key: info.Key, UploadID: info.UploadID, Initiated: info.Initiated})
+	}
+	return uploads, nil
+}
+
+// uploadError maps a MinIO error about a multipart upload to ErrUploadNotFound
+// when the upload does not exist.
+func uploadError(err error, message string) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return ErrUploadNotFound
+	}
+	return errors.New(message)
+}
@@ -3,7 +3,6 @@ package repositories
 import (
 	"time"
 
-	"github.com/aliftoriq/go-crud/initializer"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
@@ -12,22 +11,23 @@ import (
 type CacheRepository interface {
 	SetKey(ctx *gin.Context, key string, value interface{}, duration time.Duration) (err error)
 	GetValueByKey(ctx *gin.Context, key string) (value string, exists bool, err error)
+	DeleteKey(ctx *gin.Context, keys ...string) (err error)
 }
 
 type cacheRepository struct {
 	redis *redis.Client
 }
 
-func NewCacheRepository() CacheRepository {
-	return &cacheRepository{redis: initializer.RedisClient}
+func NewCacheRepository(redisClient *redis.Client) CacheRepository {
+	return &cacheRepository{redis: redisClient}
 }
 
 func (rc *cacheRepository) SetKey(ctx *gin.Context, key string, value interface{}, duration time.Duration) (err error) {
-	return initializer.RedisClient.SetEx(ctx, key, value, duration).Err()
+	return rc.redis.SetEx(ctx, key, value, duration).Err()
 }
 
 func (rc *cacheRepository) GetValueByKey(ctx *gin.Context, key string) (value string, exists bool, err error) {
-	cmd := initializer.RedisClient.Get(ctx, key)
+	cmd := rc.redis.Get(ctx, key)
 	value, err = cmd.Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -40,3 +40,7 @@ func (rc *cacheRepository) GetValueByKey(ctx *gin.Context, key string) (value st
 	exists = true
 	return
 }
+
+func (rc *cacheRepository) DeleteKey(ctx *gin.Context, keys ...string) (err error) {
+	return rc.redis.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aliftoriq/go-crud/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockery --outpkg mocks --name CommentRepository
+type CommentRepository interface {
+	CreateComment(ctx context.Context, comment *models.Comment) error
+	GetComments(ctx context.Context, articleID string, page int, limit int) (*[]models.Comment, int64, error)
+	GetCommentByID(ctx context.Context, articleID string, id string) (*models.Comment, error)
+	UpdateComment(ctx context.Context, comment *models.Comment) error
+	DeleteComment(ctx context.Context, comment *models.Comment) error
+}
+
+type commentRepository struct {
+	db *gorm.DB
+}
+
+func NewCommentRepository(db *gorm.DB) CommentRepository {
+	return &commentRepository{db: db}
+}
+
+func (cr *commentRepository) CreateComment(ctx context.Context, comment *models.Comment) error {
+	var article models.Article
+	if err := cr.db.WithContext(ctx).First(&article, comment.ArticleID).Error; err != nil {
+		return recordError(err, ErrArticleNotFound, "FAILED TO CREATE COMMENT")
+	}
+
+	if comment.ParentID != nil {
+		var parent models.Comment
+		err := cr.db.WithContext(ctx).Where("article_id = ?", comment.ArticleID).First(&parent, *comment.ParentID).Error
+		if err != nil {
+			return recordError(err, ErrParentCommentNotFound, "FAILED TO CREATE COMMENT")
+		}
+
+		// Every reply points to the top-level comment of its thread so a page
+		// of threads can be loaded with a single query.
+		rootID := parent.ID
+		if parent.RootID != nil {
+			rootID = *parent.RootID
+		}
+		comment.RootID = &rootID
+	}
+
+	if err := cr.db.WithContext(ctx).Create(comment).Error; err != nil {
+		return errors.New("FAILED TO CREATE COMMENT")
+	}
+
+	return nil
+}
+
+// GetComments returns one page of top-level comments for an article, each with
+// its replies nested below it, and the total number of top-level comments.
+func (cr *commentRepository) GetComments(ctx context.Context, articleID string, page int, limit int) (*[]models.Comment, int64, error) {
+	var total int64
+	topLevel := cr.db.WithContext(ctx).Model(&models.Comment{}).Where("article_id = ? AND parent_id IS NULL", articleID)
+	if err := topLevel.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("FAILED TO GET COMMENTS")
+	}
+
+	var roots []models.Comment
+	err := cr.db.WithContext(ctx).Where("article_id = ? AND parent_id IS NULL", articleID).
+		Order("created_at asc").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&roots).Error
+	if err != nil {
+		return nil, 0, errors.New("FAILED TO GET COMMENTS")
+	}
+
+	if len(roots) == 0 {
+		return &roots, total, nil
+	}
+
+	rootIDs := make([]uint, len(roots))
+	for i, root := range roots {
+		rootIDs[i] = root.ID
+	}
+
+	var replies []models.Comment
+	err = cr.db.WithContext(ctx).Where("root_id IN ?", rootIDs).Order("created_at asc").Find(&replies).Error
+	if err != nil {
+		return nil, 0, errors.New("FAILED TO GET COMMENTS")
+	}
+
+	children := make(map[uint][]models.Comment)
+	for _, reply := range replies {
+		children[*reply.ParentID] = append(children[*reply.ParentID], reply)
+	}
+
+	for i := range roots {
+		nestReplies(&roots[i], children)
+	}
+
+	return &roots, total, nil
+}
+
+func nestReplies(comment *models.Comment, children map[uint][]models.Comment) {
+	comment.Replies = children[comment.ID]
+	for i := range comment.Replies {
+		nestReplies(&comment.Replies[i], children)
+	}
+}
+
+func (cr *commentRepository) GetCommentByID(ctx context.Context, articleID string, id string) (*models.Comment, error) {
+	var comment models.Comment
+	if err := cr.db.WithContext(ctx).Where("article_id = ?", articleID).First(&comment, id).Error; err != nil {
+		return nil, recordError(err, ErrCommentNotFound, "FAILED TO GET COMMENT")
+	}
+
+	return &comment, nil
+}
+
+func (cr *commentRepository) UpdateComment(ctx context.Context, comment *models.Comment) error {
+	if err := cr.db.WithContext(ctx).Model(comment).Update("content", comment.Content).Error; err != nil {
+		return errors.New("FAILED TO UPDATE COMMENT")
+	}
+
+	return nil
+}
+
+// DeleteComment removes a comment together with every reply below it.
+func (cr *commentRepository) DeleteComment(ctx context.Context, comment *models.Comment) error {
+	return cr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids := []uint{comment.ID}
+		frontier := ids
+		for len(frontier) > 0 {
+			var childIDs []uint
+			if err := tx.Model(&models.Comment{}).Where("parent_id IN ?", frontier).Pluck("id", &childIDs).Error; err != nil {
+				return errors.New("FAILED TO DELETE COMMENT")
+			}
+			ids = append(ids, childIDs...)
+			frontier = childIDs
+		}
+
+		if err := tx.Delete(&models.Comment{}, ids).Error; err != nil {
+			return errors.New("FAILED TO DELETE COMMENT")
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aliftoriq/go-crud/models"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	counterKeyPrefix = "article_counters:"
+	dirtyCountersKey = "article_counters:dirty"
+	flushBatchSize   = 100
+)
+
+// CounterRepository keeps engagement counters of articles. Increments land in
+// Redis first and are folded into Postgres by Flush, so popular articles do not
+// turn their counter rows into a write hotspot.
+//
+//go:generate mockery --outpkg mocks --name CounterRepository
+type CounterRepository interface {
+	Incr(ctx context.Context, articleID int, name string, delta int64) error
+	GetCounters(ctx context.Context, articleIDs []int) (map[int]map[string]int64, error)
+	Flush(ctx context.Context) error
+	Delete(ctx context.Context, articleID int) error
+}
+
+type counterRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewCounterRepository(db *gorm.DB, redisClient *redis.Client) CounterRepository {
+	return &counterRepository{db: db, redis: redisClient}
+}
+
+func counterKey(articleID int) string {
+	return counterKeyPrefix + strconv.Itoa(articleID)
+}
+
+func (cr *counterRepository) Incr(ctx context.Context, articleID int, name string, delta int64) error {
+	pipe := cr.redis.TxPipeline()
+	pipe.HIncrBy(ctx, counterKey(articleID), name, delta)
+	pipe.SAdd(ctx, dirtyCountersKey, articleID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetCounters returns the current counters of the given articles: the values
+// stored in Postgres plus the increments still pending in Redis.
+func (cr *counterRepository) GetCounters(ctx context.Context, articleIDs []int) (map[int]map[string]int64, error) {
+	counters := make(map[int]map[string]int64, len(articleIDs))
+	if len(articleIDs) == 0 {
+		return counters, nil
+	}
+
+	var rows []models.ArticleCounter
+	if err := cr.db.WithContext(ctx).Where("article_id IN ?", articleIDs).Find(&rows).Error; err != nil {
+		return nil, errors.New("FAILED TO GET COUNTERS")
+	}
+
+	add := func(articleID int, name string, value int64) {
+		if counters[articleID] == nil {
+			counters[articleID] = make(map[string]int64)
+		}
+		counters[articleID][name] += value
+	}
+
+	for _, row := range rows {
+		add(row.ArticleID, row.Name, row.Value)
+	}
+
+	pipe := cr.redis.Pipeline()
+	pending := make([]*redis.MapStringStringCmd, len(articleIDs))
+	for i, id := range articleIDs {
+		pending[i] = pipe.HGetAll(ctx, counterKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, id := range articleIDs {
+		for name, value := range pending[i].Val() {
+			delta, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			add(id, name, delta)
+		}
+	}
+
+	return counters, nil
+}
+
+// Flush moves the pending increments of every dirty article from Redis into
+// Postgres. Increments that cannot be written are put back for the next run.
+func (cr *counterRepository) Flush(ctx context.Context) error {
+	for {
+		ids, err := cr.redis.SPopN(ctx, dirtyCountersKey, flushBatchSize).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for i, rawID := range ids {
+			articleID, err := strconv.Atoi(rawID)
+			if err != nil {
+				continue
+			}
+
+			if err := cr.flushArticle(ctx, articleID); err != nil {
+				// Mark this article and the rest of the batch dirty again, or
+				// their increments wait for the next one to the article.
+				unflushed := make([]interface{}, 0, len(ids)-i)
+				for _, id := range ids[i:] {
+					unflushed = append(unflushed, id)
+				}
+				if restoreErr := cr.redis.SAdd(ctx, dirtyCountersKey, unflushed...).Err(); restoreErr != nil {
+					return restoreErr
+				}
+				return err
+			}
+		}
+	}
+}
+
+// Delete drops the increments of an article that are still pending in Redis,
+// for articles that are purged.
+func (cr *counterRepository) Delete(ctx context.Context, articleID int) error {
+	pipe := cr.redis.TxPipeline()
+	pipe.Del(ctx, counterKey(articleID))
+	pipe.SRem(ctx, dirtyCountersKey, articleID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (cr *counterRepository) flushArticle(ctx context.Context, articleID int) error {
+	key := counterKey(articleID)
+
+	pipe := cr.redis.TxPipeline()
+	getAll := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	var rows []models.ArticleCounter
+	for name, value := range getAll.Val() {
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || delta == 0 {
+			continue
+		}
+		rows = append(rows, models.ArticleCounter{ArticleID: articleID, Name: name, Value: delta})
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	err := cr.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "article_id"}, {Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"value": gorm.Expr("article_counters.value + excluded.value")}),
+	}).Create(&rows).Error
+	if err == nil {
+		return nil
+	}
+
+	// Put the increments back so they are not lost.
+	restore := cr.redis.TxPipeline()
+	for _, row := range rows {
+		restore.HIncrBy(ctx, key, row.Name, row.Value)
+	}
+	restore.SAdd(ctx, dirtyCountersKey, articleID)
+	if _, restoreErr := restore.Exec(ctx); restoreErr != nil {
+		return restoreErr
+	}
+
+	return errors.New("FAILED TO FLUSH COUNTERS")
+}
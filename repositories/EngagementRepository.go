@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aliftoriq/go-crud/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockery --outpkg mocks --name EngagementRepository
+type EngagementRepository interface {
+	AddReaction(ctx context.Context, reaction models.Reaction) (created bool, err error)
+	RemoveReaction(ctx context.Context, reaction models.Reaction) (removed bool, err error)
+	AddBookmark(ctx context.Context, bookmark models.Bookmark) (created bool, err error)
+	RemoveBookmark(ctx context.Context, bookmark models.Bookmark) (removed bool, err error)
+	GetBookmarks(ctx context.Context, userID int, page int, limit int) (*[]models.Article, int64, error)
+}
+
+type engagementRepository struct {
+	db *gorm.DB
+}
+
+func NewEngagementRepository(db *gorm.DB) EngagementRepository {
+	return &engagementRepository{db: db}
+}
+
+func (er *engagementRepository) articleExists(ctx context.Context, articleID int) error {
+	var article models.Article
+	if err := er.db.WithContext(ctx).First(&article, articleID).Error; err != nil {
+		return recordError(err, ErrArticleNotFound, "FAILED TO GET ARTICLE")
+	}
+	return nil
+}
+
+// AddReaction stores the reaction unless the user already reacted with the
+// same type, in which case created is false.
+func (er *engagementRepository) AddReaction(ctx context.Context, reaction models.Reaction) (bool, error) {
+	if err := er.articleExists(ctx, reaction.ArticleID); err != nil {
+		return false, err
+	}
+
+	res := er.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+	if res.Error != nil {
+		return false, errors.New("FAILED TO ADD REACTION")
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (er *engagementRepository) RemoveReaction(ctx context.Context, reaction models.Reaction) (bool, error) {
+	res := er.db.WithContext(ctx).
+		Where("user_id = ? AND article_id = ? AND type = ?", reaction.UserID, reaction.ArticleID, reaction.Type).
+		Delete(&models.Reaction{})
+	if res.Error != nil {
+		return false, errors.New("FAILED TO REMOVE REACTION")
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// AddBookmark stores the bookmark unless the user already bookmarked the
+// article, in which case created is false.
+func (er *engagementRepository) AddBookmark(ctx context.Context, bookmark models.Bookmark) (bool, error) {
+	if err := er.articleExists(ctx, bookmark.ArticleID); err != nil {
+		return false, err
+	}
+
+	res := er.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&bookmark)
+	if res.Error != nil {
+		return false, errors.New("FAILED TO ADD BOOKMARK")
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (er *engagementRepository) RemoveBookmark(ctx context.Context, bookmark models.Bookmark) (bool, error) {
+	res := er.db.WithContext(ctx).
+		Where("user_id = ? AND article_id = ?", bookmark.UserID, bookmark.ArticleID).
+		Delete(&models.Bookmark{})
+	if res.Error != nil {
+		return false, errors.New("FAILED TO REMOVE BOOKMARK")
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// GetBookmarks returns one page of the articles bookmarked by a user, most
+// recently bookmarked first, and the total number of bookmarks.
+func (er *engagementRepository) GetBookmarks(ctx context.Context, userID int, page int, limit int) (*[]models.Article, int64, error) {
+	bookmarked := func() *gorm.DB {
+		return er.db.WithContext(ctx).Model(&models.Article{}).
+			Joins("JOIN bookmarks ON bookmarks.article_id = articles.id").
+			Where("bookmarks.user_id = ?", userID)
+	}
+
+	var total int64
+	if err := bookmarked().Count(&total).Error; err != nil {
+		return nil, 0, errors.New("FAILED TO GET BOOKMARKS")
+	}
+
+	var articles []models.Article
+	err := bookmarked().
+		Order("bookmarks.created_at desc").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&articles).Error
+	if err != nil {
+		return nil, 0, errors.New("FAILED TO GET BOOKMARKS")
+	}
+
+	return &articles, total, nil
+}
@@ -0,0 +1,451 @@
+package repositories
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// localBucketRepository stores objects as files below a root directory:
+//
+//	<root>/<bucket>/objects/<object name>      the content
+//	<root>/<bucket>/meta/<object name>.json    content type and ETag
+//	<root>/<bucket>/uploads/<upload id>/       parts of multipart uploads
+//
+// Files are written to <root>/<bucket>/tmp first and renamed into place, so
+// readers never see a partially written object.
+type localBucketRepository struct {
+	root string
+}
+
+type localObjectMeta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+type localUpload struct {
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Initiated   time.Time `json:"initiated"`
+}
+
+func NewLocalBucketRepository(root string) BucketRepository {
+	return &localBucketRepository{root: root}
+}
+
+func (lr *localBucketRepository) PutObject(ctx context.Context, bName string, oName string, file io.Reader, fileSize int64, contentType string) error {
+	if err := validObjectName(bName, oName); err != nil {
+		return err
+	}
+
+	tmp, etag, err := lr.writeTemp(bName, file, fileSize)
+	if err != nil {
+		return err
+	}
+
+	return lr.commit(bName, oName, tmp, localObjectMeta{ContentType: contentType, ETag: etag})
+}
+
+func (lr *localBucketRepository) GetObject(ctx context.Context, bName string, oName string) (io.ReadSeekCloser, error) {
+	if err := validObjectName(bName, oName); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(lr.objectPath(bName, oName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, errors.New("FAILED TO GET OBJECT")
+	}
+	return file, nil
+}
+
+func (lr *localBucketRepository) StatObject(ctx context.Context, bName string, oName string) (ObjectInfo, error) {
+	if err := validObjectName(bName, oName); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stat, err := os.Stat(lr.objectPath(bName, oName))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && stat.IsDir()) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, errors.New("FAILED TO STAT OBJECT")
+	}
+
+	var meta localObjectMeta
+	if err := readJSON(lr.metaPath(bName, oName), &meta); err != nil {
+		return ObjectInfo{}, errors.New("FAILED TO STAT OBJECT")
+	}
+
+	return ObjectInfo{
+		Key:          oName,
+		Size:         stat.Size(),
+		ContentType:  meta.ContentType,
+		ETag:         meta.ETag,
+		LastModified: stat.ModTime().UTC(),
+	}, nil
+}
+
+func (lr *localBucketRepository) ListObjects(ctx context.Context, bName string, prefix string) ([]ObjectInfo, error) {
+	if err := validObjectName(bName, "x"); err != nil {
+		return nil, err
+	}
+
+	objectsDir := filepath.Join(lr.root, bName, "objects")
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(objectsDir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == objectsDir {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(objectsDir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := lr.StatObject(ctx, bName, key)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, info)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("FAILED TO LIST OBJECTS")
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (lr *localBucketRepository) DeleteObject(ctx context.Context, bName string, oName string) error {
+	if err := validObjectName(bName, oName); err != nil {
+		return err
+	}
+
+	for _, p := range []string{lr.objectPath(bName, oName), lr.metaPath(bName, oName)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.New("FAILED TO DELETE OBJECT")
+		}
+	}
+
+	// Drop directories left empty, e.g. those of deleted variants. Removing a
+	// directory that is not empty fails, which ends the walk.
+	for _, dir := range []string{"objects", "meta"} {
+		base := filepath.Join(lr.root, bName, dir)
+		for p := filepath.Dir(filepath.Join(base, filepath.FromSlash(oName))); p != base; p = filepath.Dir(p) {
+			if os.Remove(p) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (lr *localBucketRepository) PresignPutObject(ctx context.Context, bName string, oName string, expiry time.Duration, contentType string, size int64) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+func (lr *localBucketRepository) PresignGetObject(ctx context.Context, bName string, oName string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+func (lr *localBucketRepository) NewMultipartUpload(ctx context.Context, bName string, oName string, contentType string) (string, error) {
+	if err := validObjectName(bName, oName); err != nil {
+		return "", err
+	}
+
+	uploadID := uuid.NewString()
+	dir := lr.uploadPath(bName, uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", errors.New("FAILED TO START UPLOAD")
+	}
+
+	upload := localUpload{Key: oName, ContentType: contentType, Initiated: time.Now().UTC()}
+	if err := writeJSON(filepath.Join(dir, "upload.json"), upload); err != nil {
+		os.RemoveAll(dir)
+		return "", errors.New("FAILED TO START UPLOAD")
+	}
+
+	return uploadID, nil
+}
+
+func (lr *localBucketRepository) PutObjectPart(ctx context.Context, bName string, oName string, uploadID string, partNumber int, data io.Reader, size int64) (ObjectPart, error) {
+	dir, _, err := lr.upload(bName, oName, uploadID)
+	if err != nil {
+		return ObjectPart{}, err
+	}
+
+	tmp, etag, err := lr.writeTemp(bName, data, size)
+	if err != nil {
+		return ObjectPart{}, err
+	}
+
+	// The ETag is part of the file name, so a part and its ETag are replaced
+	// together by a single rename.
+	number := strconv.Itoa(partNumber)
+	old, _ := filepath.Glob(filepath.Join(dir, number+".*"))
+	if err := os.Rename(tmp, filepath.Join(dir, number+"."+etag)); err != nil {
+		os.Remove(tmp)
+		return ObjectPart{}, errors.New("FAILED TO UPLOAD PART")
+	}
+	for _, p := range old {
+		if filepath.Base(p) != number+"."+etag {
+			os.Remove(p)
+		}
+	}
+
+	return ObjectPart{PartNumber: partNumber, ETag: etag, Size: size}, nil
+}
+
+func (lr *localBucketRepository) ListObjectParts(ctx context.Context, bName string, oName string, uploadID string) ([]ObjectPart, error) {
+	dir, _, err := lr.upload(bName, oName, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.New("FAILED TO LIST PARTS")
+	}
+
+	var parts []ObjectPart
+	for _, entry := range entries {
+		number, etag, ok := strings.Cut(entry.Name(), ".")
+		n, err := strconv.Atoi(number)
+		if !ok || err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, errors.New("FAILED TO LIST PARTS")
+		}
+		parts = append(parts, ObjectPart{PartNumber: n, ETag: etag, Size: info.Size()})
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func (lr *localBucketRepository) CompleteMultipartUpload(ctx context.Context, bName string, oName string, uploadID string, parts []ObjectPart) error {
+	dir, upload, err := lr.upload(bName, oName, uploadID)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return errors.New("FAILED TO COMPLETE UPLOAD")
+		}
+
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(part.PartNumber)+"."+part.ETag))
+		if err != nil {
+			return errors.New("FAILED TO COMPLETE UPLOAD")
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	tmp, etag, err := lr.writeTemp(bName, io.MultiReader(readers...), -1)
+	if err != nil {
+		return errors.New("FAILED TO COMPLETE UPLOAD")
+	}
+
+	if err := lr.commit(bName, oName, tmp, localObjectMeta{ContentType: upload.ContentType, ETag: etag}); err != nil {
+		return err
+	}
+
+	os.RemoveAll(dir)
+	return nil
+}
+
+func (lr *localBucketRepository) AbortMultipartUpload(ctx context.Context, bName string, oName string, uploadID string) error {
+	dir, _, err := lr.upload(bName, oName, uploadID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.New("FAILED TO ABORT UPLOAD")
+	}
+	return nil
+}
+
+func (lr *localBucketRepository) ListIncompleteUploads(ctx context.Context, bName string) ([]IncompleteUpload, error) {
+	if err := validObjectName(bName, "x"); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(lr.root, bName, "uploads"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("FAILED TO LIST UPLOADS")
+	}
+
+	var uploads []IncompleteUpload
+	for _, entry := range entries {
+		var upload localUpload
+		if err := readJSON(filepath.Join(lr.uploadPath(bName, entry.Name()), "upload.json"), &upload); err != nil {
+			continue
+		}
+		uploads = append(uploads, IncompleteUpload{Key: upload.Key, UploadID: entry.Name(), Initiated: upload.Initiated})
+	}
+	return uploads, nil
+}
+
+// upload loads a multipart upload and checks that it belongs to the object.
+func (lr *localBucketRepository) upload(bName string, oName string, uploadID string) (string, localUpload, error) {
+	var upload localUpload
+	if err := validObjectName(bName, oName); err != nil {
+		return "", upload, err
+	}
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", upload, ErrUploadNotFound
+	}
+
+	dir := lr.uploadPath(bName, uploadID)
+	if err := readJSON(filepath.Join(dir, "upload.json"), &upload); err != nil || upload.Key != oName {
+		return "", upload, ErrUploadNotFound
+	}
+	return dir, upload, nil
+}
+
+// writeTemp copies r into a new temporary file of the bucket and returns its
+// path and the MD5 ETag of the content. A negative size is not checked.
+func (lr *localBucketRepository) writeTemp(bName string, r io.Reader, size int64) (string, string, error) {
+	dir := filepath.Join(lr.root, bName, "tmp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", errors.New("FAILED TO WRITE OBJECT")
+	}
+
+	file, err := os.CreateTemp(dir, "object-*")
+	if err != nil {
+		return "", "", errors.New("FAILED TO WRITE OBJECT")
+	}
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = errors.New("OBJECT SIZE DOES NOT MATCH")
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+
+	return file.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// commit moves a temporary file into place as the object and records its
+// metadata.
+func (lr *localBucketRepository) commit(bName string, oName string, tmp string, meta localObjectMeta) error {
+	objectPath := lr.objectPath(bName, oName)
+	metaPath := lr.metaPath(bName, oName)
+
+	if err := writeJSON(metaPath, meta); err != nil {
+		os.Remove(tmp)
+		return errors.New("FAILED TO WRITE OBJECT")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		os.Remove(tmp)
+		return errors.New("FAILED TO WRITE OBJECT")
+	}
+	if err := os.Rename(tmp, objectPath); err != nil {
+		os.Remove(tmp)
+		return errors.New("FAILED TO WRITE OBJECT")
+	}
+
+	return nil
+}
+
+func (lr *localBucketRepository) objectPath(bName string, oName string) string {
+	return filepath.Join(lr.root, bName, "objects", filepath.FromSlash(oName))
+}
+
+func (lr *localBucketRepository) metaPath(bName string, oName string) string {
+	return filepath.Join(lr.root, bName, "meta", filepath.FromSlash(oName)+".json")
+}
+
+func (lr *localBucketRepository) uploadPath(bName string, uploadID string) string {
+	return filepath.Join(lr.root, bName, "uploads", uploadID)
+}
+
+// validObjectName rejects names that would escape the bucket directory.
+func validObjectName(bName string, oName string) error {
+	if bName == "" || bName == "." || bName == ".." || strings.ContainsAny(bName, `/\`) {
+		return errors.New("INVALID BUCKET NAME")
+	}
+	if oName == "" || oName == "." || strings.HasPrefix(oName, "/") || strings.Contains(oName, `\`) ||
+		path.Clean(oName) != oName || oName == ".." || strings.HasPrefix(oName, "../") {
+		return ErrInvalidObjectName
+	}
+	return nil
+}
+
+func readJSON(p string, v interface{}) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON writes v to p through a temporary file, so p is replaced at once.
+func writeJSON(p string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), p)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
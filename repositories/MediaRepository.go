@@ -0,0 +1,283 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aliftoriq/go-crud/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockery --outpkg mocks --name MediaRepository
+type MediaRepository interface {
+	CreateMedia(ctx context.Context, media *models.Media) error
+	CreateMediaWithinQuota(ctx context.Context, media *models.Media, quota int64) (MediaUsage, error)
+	GetMediaByObjectName(ctx context.Context, objectName string) (*models.Media, error)
+	GetMediaByArticle(ctx context.Context, articleID string) (*[]models.Media, error)
+	AttachToArticle(ctx context.Context, media *models.Media, articleID int, cover bool) error
+	DetachFromArticle(ctx context.Context, media *models.Media) error
+	DeleteMedia(ctx context.Context, media *models.Media) error
+	GetMediaByUser(ctx context.Context, userID int, page int, limit int) (*[]models.Media, int64, error)
+	GetUsage(ctx context.Context, userID int) (MediaUsage, error)
+	AddVariantSize(ctx context.Context, objectName string, size int64) error
+	GetMediaWithoutSize(ctx context.Context, afterID uint, limit int) (*[]models.Media, error)
+	SetSize(ctx context.Context, media *models.Media, size int64) error
+	GetAllObjectNames(ctx context.Context) ([]string, error)
+	SetStatus(ctx context.Context, media *models.Media, status string) error
+	GetPendingMedia(ctx context.Context, createdBefore time.Time, limit int) (*[]models.Media, error)
+	GetOldestMedia(ctx context.Context) (*models.Media, error)
+	AddScanAttempt(ctx context.Context, media *models.Media) error
+}
+
+// MediaUsage is the storage used by the media of a user, including their
+// variants.
+type MediaUsage struct {
+	Count int64 `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+type mediaRepository struct {
+	db *gorm.DB
+}
+
+func NewMediaRepository(db *gorm.DB) MediaRepository {
+	return &mediaRepository{db: db}
+}
+
+func (mr *mediaRepository) CreateMedia(ctx context.Context, media *models.Media) error {
+	if err := mr.db.WithContext(ctx).Create(media).Error; err != nil {
+		return errors.New("FAILED TO CREATE MEDIA")
+	}
+	return nil
+}
+
+// CreateMediaWithinQuota creates the media unless it would take the storage of
+// its user over quota, in which case it returns ErrQuotaExceeded and the
+// usage. The row of the user is locked while the usage is summed, so
+// concurrent uploads of the user are checked one after another.
+func (mr *mediaRepository) CreateMediaWithinQuota(ctx context.Context, media *models.Media, quota int64) (MediaUsage, error) {
+	var usage MediaUsage
+	err := mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, media.UserID).Error; err != nil {
+			return recordError(err, ErrUserNotFound, "FAILED TO CREATE MEDIA")
+		}
+
+		var err error
+		if usage, err = getUsage(tx, media.UserID); err != nil {
+			return err
+		}
+		if usage.Bytes+media.Size > quota {
+			return ErrQuotaExceeded
+		}
+
+		if err := tx.Create(media).Error; err != nil {
+			return errors.New("FAILED TO CREATE MEDIA")
+		}
+		return nil
+	})
+	return usage, err
+}
+
+func (mr *mediaRepository) GetMediaByObjectName(ctx context.Context, objectName string) (*models.Media, error) {
+	var media models.Media
+	if err := mr.db.WithContext(ctx).Where("object_name = ?", objectName).First(&media).Error; err != nil {
+		return nil, recordError(err, ErrMediaNotFound, "FAILED TO GET MEDIA")
+	}
+	return &media, nil
+}
+
+func (mr *mediaRepository) GetMediaByArticle(ctx context.Context, articleID string) (*[]models.Media, error) {
+	var media []models.Media
+	if err := mr.db.WithContext(ctx).Where("article_id = ?", articleID).Order("created_at asc").Find(&media).Error; err != nil {
+		return nil, errors.New("FAILED TO GET MEDIA")
+	}
+	return &media, nil
+}
+
+// AttachToArticle links the media to an article, moving it away from any
+// article it was attached to before, and optionally makes it the cover image.
+func (mr *mediaRepository) AttachToArticle(ctx context.Context, media *models.Media, articleID int, cover bool) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if media.ArticleID != nil && *media.ArticleID != articleID {
+			if err := clearCoverImage(tx, *media.ArticleID, media.ObjectName); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(media).Update("article_id", articleID).Error; err != nil {
+			return errors.New("FAILED TO ATTACH MEDIA")
+		}
+
+		if cover {
+			err := tx.Model(&models.Article{}).Where("id = ?", articleID).Update("cover_image", media.ObjectName).Error
+			if err != nil {
+				return errors.New("FAILED TO SET COVER IMAGE")
+			}
+		}
+
+		return nil
+	})
+}
+
+// DetachFromArticle unlinks the media from its article, clearing the cover
+// image if it was the cover.
+func (mr *mediaRepository) DetachFromArticle(ctx context.Context, media *models.Media) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if media.ArticleID != nil {
+			if err := clearCoverImage(tx, *media.ArticleID, media.ObjectName); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(media).Update("article_id", nil).Error; err != nil {
+			return errors.New("FAILED TO DETACH MEDIA")
+		}
+
+		return nil
+	})
+}
+
+func (mr *mediaRepository) DeleteMedia(ctx context.Context, media *models.Media) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if media.ArticleID != nil {
+			if err := clearCoverImage(tx, *media.ArticleID, media.ObjectName); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Delete(media).Error; err != nil {
+			return errors.New("FAILED TO DELETE MEDIA")
+		}
+
+		return nil
+	})
+}
+
+// GetMediaByUser returns one page of the media uploaded by a user, newest
+// first, and the total number of media.
+func (mr *mediaRepository) GetMediaByUser(ctx context.Context, userID int, page int, limit int) (*[]models.Media, int64, error) {
+	var total int64
+	if err := mr.db.WithContext(ctx).Model(&models.Media{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, errors.New("FAILED TO GET MEDIA")
+	}
+
+	var media []models.Media
+	err := mr.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("created_at desc").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&media).Error
+	if err != nil {
+		return nil, 0, errors.New("FAILED TO GET MEDIA")
+	}
+
+	return &media, total, nil
+}
+
+func (mr *mediaRepository) GetUsage(ctx context.Context, userID int) (MediaUsage, error) {
+	return getUsage(mr.db.WithContext(ctx), userID)
+}
+
+func getUsage(db *gorm.DB, userID int) (MediaUsage, error) {
+	var usage MediaUsage
+	err := db.Model(&models.Media{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size + variants_size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Scan(&usage).Error
+	if err != nil {
+		return usage, errors.New("FAILED TO GET STORAGE USAGE")
+	}
+	return usage, nil
+}
+
+// AddVariantSize counts a variant generated from the image stored as
+// objectName toward the storage of its media. Objects without media are
+// ignored.
+func (mr *mediaRepository) AddVariantSize(ctx context.Context, objectName string, size int64) error {
+	err := mr.db.WithContext(ctx).Model(&models.Media{}).
+		Where("object_name = ?", objectName).
+		Update("variants_size", gorm.Expr("variants_size + ?", size)).Error
+	if err != nil {
+		return errors.New("FAILED TO UPDATE MEDIA")
+	}
+	return nil
+}
+
+// GetMediaWithoutSize returns media uploaded before sizes were recorded, in
+// batches ordered by ID.
+func (mr *mediaRepository) GetMediaWithoutSize(ctx context.Context, afterID uint, limit int) (*[]models.Media, error) {
+	var media []models.Media
+	if err := mr.db.WithContext(ctx).Where("size = 0 AND id > ?", afterID).Order("id").Limit(limit).Find(&media).Error; err != nil {
+		return nil, errors.New("FAILED TO GET MEDIA")
+	}
+	return &media, nil
+}
+
+func (mr *mediaRepository) SetSize(ctx context.Context, media *models.Media, size int64) error {
+	if err := mr.db.WithContext(ctx).Model(media).Update("size", size).Error; err != nil {
+		return errors.New("FAILED TO UPDATE MEDIA")
+	}
+	return nil
+}
+
+// GetAllObjectNames returns the object name of every media, i.e. every object
+// the database refers to.
+func (mr *mediaRepository) GetAllObjectNames(ctx context.Context) ([]string, error) {
+	var names []string
+	if err := mr.db.WithContext(ctx).Model(&models.Media{}).Pluck("object_name", &names).Error; err != nil {
+		return nil, errors.New("FAILED TO GET MEDIA")
+	}
+	return names, nil
+}
+
+func (mr *mediaRepository) SetStatus(ctx context.Context, media *models.Media, status string) error {
+	if err := mr.db.WithContext(ctx).Model(media).Update("status", status).Error; err != nil {
+		return errors.New("FAILED TO UPDATE MEDIA")
+	}
+	return nil
+}
+
+// GetPendingMedia returns media whose upload has not been scanned yet, those
+// with the fewest failed scans first and then the oldest, so uploads that keep
+// failing do not hold back the others.
+func (mr *mediaRepository) GetPendingMedia(ctx context.Context, createdBefore time.Time, limit int) (*[]models.Media, error) {
+	var media []models.Media
+	err := mr.db.WithContext(ctx).Where("status = ? AND created_at < ?", models.MediaStatusPending, createdBefore).
+		Order("scan_attempts, created_at").
+		Limit(limit).
+		Find(&media).Error
+	if err != nil {
+		return nil, errors.New("FAILED TO GET MEDIA")
+	}
+	return &media, nil
+}
+
+func (mr *mediaRepository) AddScanAttempt(ctx context.Context, media *models.Media) error {
+	err := mr.db.WithContext(ctx).Model(media).UpdateColumn("scan_attempts", gorm.Expr("scan_attempts + 1")).Error
+	if err != nil {
+		return errors.New("FAILED TO UPDATE MEDIA")
+	}
+	return nil
+}
+
+// GetOldestMedia returns the media created first.
+func (mr *mediaRepository) GetOldestMedia(ctx context.Context) (*models.Media, error) {
+	var media models.Media
+	if err := mr.db.WithContext(ctx).Order("created_at").First(&media).Error; err != nil {
+		return nil, recordError(err, ErrMediaNotFound, "FAILED TO GET MEDIA")
+	}
+	return &media, nil
+}
+
+func clearCoverImage(tx *gorm.DB, articleID int, objectName string) error {
+	err := tx.Model(&models.Article{}).
+		Where("id = ? AND cover_image = ?", articleID, objectName).
+		Update("cover_image", "").Error
+	if err != nil {
+		return errors.New("FAILED TO CLEAR COVER IMAGE")
+	}
+	return nil
+}
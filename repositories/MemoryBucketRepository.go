@@ -0,0 +1,266 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+type memoryUpload struct {
+	bucket      string
+	key         string
+	contentType string
+	initiated   time.Time
+	parts       map[int]memoryObject
+}
+
+// memoryBucketRepository keeps objects in memory. It is meant for tests and
+// local runs; everything is lost when the process exits.
+type memoryBucketRepository struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]memoryObject
+	uploads map[string]*memoryUpload
+}
+
+func NewMemoryBucketRepository() BucketRepository {
+	return &memoryBucketRepository{
+		buckets: make(map[string]map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+func (mr *memoryBucketRepository) PutObject(ctx context.Context, bName string, oName string, file io.Reader, fileSize int64, contentType string) error {
+	data, err := readExactly(file, fileSize)
+	if err != nil {
+		return err
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.putLocked(bName, oName, data, contentType)
+	return nil
+}
+
+func (mr *memoryBucketRepository) putLocked(bName string, oName string, data []byte, contentType string) {
+	bucket, ok := mr.buckets[bName]
+	if !ok {
+		bucket = make(map[string]memoryObject)
+		mr.buckets[bName] = bucket
+	}
+
+	bucket[oName] = memoryObject{
+		data: data,
+		info: ObjectInfo{
+			Key:          oName,
+			Size:         int64(len(data)),
+			ContentType:  contentType,
+			ETag:         etagOf(data),
+			LastModified: time.Now().UTC(),
+		},
+	}
+}
+
+func (mr *memoryBucketRepository) GetObject(ctx context.Context, bName string, oName string) (io.ReadSeekCloser, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	object, ok := mr.buckets[bName][oName]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	// Stored data is never modified in place, so readers can share it.
+	return nopReadSeekCloser{bytes.NewReader(object.data)}, nil
+}
+
+func (mr *memoryBucketRepository) StatObject(ctx context.Context, bName string, oName string) (ObjectInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	object, ok := mr.buckets[bName][oName]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return object.info, nil
+}
+
+func (mr *memoryBucketRepository) ListObjects(ctx context.Context, bName string, prefix string) ([]ObjectInfo, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, object := range mr.buckets[bName] {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, object.info)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (mr *memoryBucketRepository) DeleteObject(ctx context.Context, bName string, oName string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	delete(mr.buckets[bName], oName)
+	return nil
+}
+
+func (mr *memoryBucketRepository) PresignPutObject(ctx context.Context, bName string, oName string, expiry time.Duration, contentType string, size int64) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+func (mr *memoryBucketRepository) PresignGetObject(ctx context.Context, bName string, oName string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+func (mr *memoryBucketRepository) NewMultipartUpload(ctx context.Context, bName string, oName string, contentType string) (string, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	uploadID := uuid.NewString()
+	mr.uploads[uploadID] = &memoryUpload{
+		bucket:      bName,
+		key:         oName,
+		contentType: contentType,
+		initiated:   time.Now().UTC(),
+		parts:       make(map[int]memoryObject),
+	}
+	return uploadID, nil
+}
+
+func (mr *memoryBucketRepository) PutObjectPart(ctx context.Context, bName string, oName string, uploadID string, partNumber int, data io.Reader, size int64) (ObjectPart, error) {
+	content, err := readExactly(data, size)
+	if err != nil {
+		return ObjectPart{}, err
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	upload, err := mr.uploadLocked(bName, oName, uploadID)
+	if err != nil {
+		return ObjectPart{}, err
+	}
+
+	part := memoryObject{
+		data: content,
+		info: ObjectInfo{Size: int64(len(content)), ETag: etagOf(content)},
+	}
+	upload.parts[partNumber] = part
+
+	return ObjectPart{PartNumber: partNumber, ETag: part.info.ETag, Size: part.info.Size}, nil
+}
+
+func (mr *memoryBucketRepository) ListObjectParts(ctx context.Context, bName string, oName string, uploadID string) ([]ObjectPart, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	upload, err := mr.uploadLocked(bName, oName, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []ObjectPart
+	for n, part := range upload.parts {
+		parts = append(parts, ObjectPart{PartNumber: n, ETag: part.info.ETag, Size: part.info.Size})
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func (mr *memoryBucketRepository) CompleteMultipartUpload(ctx context.Context, bName string, oName string, uploadID string, parts []ObjectPart) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	upload, err := mr.uploadLocked(bName, oName, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for i, part := range parts {
+		stored, ok := upload.parts[part.PartNumber]
+		if !ok || stored.info.ETag != part.ETag || (i > 0 && part.PartNumber <= parts[i-1].PartNumber) {
+			return errors.New("FAILED TO COMPLETE UPLOAD")
+		}
+		buf.Write(stored.data)
+	}
+
+	mr.putLocked(bName, oName, buf.Bytes(), upload.contentType)
+	delete(mr.uploads, uploadID)
+	return nil
+}
+
+func (mr *memoryBucketRepository) AbortMultipartUpload(ctx context.Context, bName string, oName string, uploadID string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, err := mr.uploadLocked(bName, oName, uploadID); err != nil {
+		return err
+	}
+	delete(mr.uploads, uploadID)
+	return nil
+}
+
+func (mr *memoryBucketRepository) ListIncompleteUploads(ctx context.Context, bName string) ([]IncompleteUpload, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var uploads []IncompleteUpload
+	for uploadID, upload := range mr.uploads {
+		if upload.bucket == bName {
+			uploads = append(uploads, IncompleteUpload{Key: upload.key, UploadID: uploadID, Initiated: upload.initiated})
+		}
+	}
+	return uploads, nil
+}
+
+func (mr *memoryBucketRepository) uploadLocked(bName string, oName string, uploadID string) (*memoryUpload, error) {
+	upload, ok := mr.uploads[uploadID]
+	if !ok || upload.bucket != bName || upload.key != oName {
+		return nil, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// readExactly reads all of r and checks that it was size bytes long. A
+// negative size means the size is not known up front.
+func readExactly(r io.Reader, size int64) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return nil, errors.New("OBJECT SIZE DOES NOT MATCH")
+	}
+	return data, nil
+}
+
+// etagOf returns the ETag S3 gives an object uploaded in one piece.
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
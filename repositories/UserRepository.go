@@ -1,57 +1,91 @@
 package repositories
 
 import (
-	"github.com/aliftoriq/go-crud/initializer"
+	"context"
+	"errors"
+
 	"github.com/aliftoriq/go-crud/models"
 	"gorm.io/gorm"
 )
 
 //go:generate mockery --outpkg mocks --name UserRepository
 type UserRepository interface {
-	FindUserByEmail(email string) (*models.User, error)
-	CreateUser(user *models.User) error
-	FindByID(id string) (*models.User, error)
-	FindByEmail(email string) (*models.User, error)
-	Update(user *models.User) error
-	Delete(user *models.User) error
+	FindUserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	UpdatePassword(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, user *models.User) error
 }
 
 type userRepository struct {
 	db *gorm.DB
 }
 
-func NewUserRepository() UserRepository {
-	return &userRepository{db: initializer.DB}
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
 }
 
-func (ur *userRepository) FindUserByEmail(email string) (*models.User, error) {
+func (ur *userRepository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	if err := ur.db.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
+	if err := ur.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, recordError(err, ErrUserNotFound, "FAILED TO GET USER")
 	}
 	return &user, nil
 }
 
-func (ur *userRepository) CreateUser(user *models.User) error {
-	return ur.db.Create(user).Error
+// CreateUser returns ErrEmailTaken when another user has the email.
+func (ur *userRepository) CreateUser(ctx context.Context, user *models.User) error {
+	if err := ur.db.WithContext(ctx).Create(user).Error; err != nil {
+		if uniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return errors.New("FAILED TO CREATE USER")
+	}
+	return nil
 }
 
-func (ur *userRepository) FindByID(id string) (*models.User, error) {
+func (ur *userRepository) FindByID(ctx context.Context, id string) (*models.User, error) {
 	user := &models.User{}
-	err := ur.db.First(user, id).Error
-	return user, err
+	if err := ur.db.WithContext(ctx).First(user, id).Error; err != nil {
+		return nil, recordError(err, ErrUserNotFound, "FAILED TO GET USER")
+	}
+	return user, nil
 }
 
-func (ur *userRepository) FindByEmail(email string) (*models.User, error) {
+func (ur *userRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
-	err := ur.db.Where("email = ?", email).First(user).Error
-	return user, err
+	if err := ur.db.WithContext(ctx).Where("email = ?", email).First(user).Error; err != nil {
+		return nil, recordError(err, ErrUserNotFound, "FAILED TO GET USER")
+	}
+	return user, nil
 }
 
-func (ur *userRepository) Update(user *models.User) error {
-	return ur.db.Save(user).Error
+// Update returns ErrEmailTaken when another user has the new email.
+func (ur *userRepository) Update(ctx context.Context, user *models.User) error {
+	if err := ur.db.WithContext(ctx).Save(user).Error; err != nil {
+		if uniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return errors.New("FAILED TO UPDATE USER")
+	}
+	return nil
 }
 
-func (ur *userRepository) Delete(user *models.User) error {
-	return ur.db.Unscoped().Delete(user).Error
+// UpdatePassword only saves the password of the user, so it cannot undo a
+// concurrent update of the other fields.
+func (ur *userRepository) UpdatePassword(ctx context.Context, user *models.User) error {
+	err := ur.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Update("password", user.Password).Error
+	if err != nil {
+		return errors.New("FAILED TO UPDATE PASSWORD")
+	}
+	return nil
+}
+
+func (ur *userRepository) Delete(ctx context.Context, user *models.User) error {
+	if err := ur.db.WithContext(ctx).Unscoped().Delete(user).Error; err != nil {
+		return errors.New("FAILED TO DELETE USER")
+	}
+	return nil
 }
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	viewKeyPrefix     = "article_view:"
+	trendingKeyPrefix = "trending:"
+	trendingBucket    = time.Hour
+	// TrendingMaxWindow is the longest window the trending feed can rank over.
+	TrendingMaxWindow = 7 * 24 * time.Hour
+	trendingCacheTTL  = time.Minute
+)
+
+// TrendingArticle is one entry of the trending feed.
+type TrendingArticle struct {
+	ArticleID int
+	Score     float64
+}
+
+// ViewRepository deduplicates article views and ranks articles by recent views.
+//
+//go:generate mockery --outpkg mocks --name ViewRepository
+type ViewRepository interface {
+	RecordView(ctx context.Context, articleID int, viewer string, dedupWindow time.Duration) (counted bool, err error)
+	GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingArticle, error)
+	RemoveArticle(ctx context.Context, articleID int) error
+}
+
+type viewRepository struct {
+	redis *redis.Client
+}
+
+func NewViewRepository(redisClient *redis.Client) ViewRepository {
+	return &viewRepository{redis: redisClient}
+}
+
+func trendingBucketKey(start time.Time) string {
+	return trendingKeyPrefix + strconv.FormatInt(start.Unix(), 10)
+}
+
+// RecordView counts a view of the article unless the same viewer already viewed
+// it within dedupWindow. Counted views go into the hourly trending bucket.
+func (vr *viewRepository) RecordView(ctx context.Context, articleID int, viewer string, dedupWindow time.Duration) (bool, error) {
+	id := strconv.Itoa(articleID)
+
+	first, err := vr.redis.SetNX(ctx, viewKeyPrefix+id+":"+viewer, 1, dedupWindow).Result()
+	if err != nil || !first {
+		return false, err
+	}
+
+	bucket := trendingBucketKey(time.Now().Truncate(trendingBucket))
+	pipe := vr.redis.TxPipeline()
+	pipe.ZIncrBy(ctx, bucket, 1, id)
+	pipe.Expire(ctx, bucket, TrendingMaxWindow+trendingBucket)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// GetTrending ranks articles by their views in the hourly buckets covering the
+// window. Each bucket is weighted with a half-life of a quarter of the window,
+// so recent views count more than old ones. Rankings are cached briefly.
+func (vr *viewRepository) GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingArticle, error) {
+	resultKey := trendingKeyPrefix + "result:" + window.String()
+	// An empty ranking stores no key, so it is cached with a marker instead.
+	emptyKey := resultKey + ":empty"
+
+	exists, err := vr.redis.Exists(ctx, resultKey, emptyKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		now := time.Now()
+		halfLife := window / 4
+
+		var keys []string
+		var weights []float64
+		for start := now.Truncate(trendingBucket); now.Sub(start) < window; start = start.Add(-trendingBucket) {
+			age := now.Sub(start)
+			keys = append(keys, trendingBucketKey(start))
+			weights = append(weights, math.Pow(0.5, float64(age)/float64(halfLife)))
+		}
+
+		pipe := vr.redis.TxPipeline()
+		union := pipe.ZUnionStore(ctx, resultKey, &redis.ZStore{
+			Keys:      keys,
+			Weights:   weights,
+			Aggregate: "SUM",
+		})
+		pipe.Expire(ctx, resultKey, trendingCacheTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+
+		if union.Val() == 0 {
+			if err := vr.redis.Set(ctx, emptyKey, 1, trendingCacheTTL).Err(); err != nil {
+				return nil, err
+			}
+			return []TrendingArticle{}, nil
+		}
+	}
+
+	ranked, err := vr.redis.ZRevRangeWithScores(ctx, resultKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	trending := make([]TrendingArticle, 0, len(ranked))
+	for _, z := range ranked {
+		articleID, err := strconv.Atoi(z.Member.(string))
+		if err != nil {
+			continue
+		}
+		trending = append(trending, TrendingArticle{ArticleID: articleID, Score: z.Score})
+	}
+
+	return trending, nil
+}
+
+// RemoveArticle takes an article that is purged out of the trending buckets
+// and drops the cached rankings, which may still list it.
+func (vr *viewRepository) RemoveArticle(ctx context.Context, articleID int) error {
+	id := strconv.Itoa(articleID)
+
+	now := time.Now()
+	pipe := vr.redis.TxPipeline()
+	for start := now.Truncate(trendingBucket); now.Sub(start) <= TrendingMaxWindow; start = start.Add(-trendingBucket) {
+		pipe.ZRem(ctx, trendingBucketKey(start), id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	var results []string
+	iter := vr.redis.Scan(ctx, 0, trendingKeyPrefix+"result:*", 100).Iterator()
+	for iter.Next(ctx) {
+		results = append(results, iter.Val())
+	}
+	if err := iter.Err(); err != nil || len(results) == 0 {
+		return err
+	}
+	return vr.redis.Del(ctx, results...).Err()
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// The kinds of errors the repositories return on purpose. Every error below
+// wraps one of them, so callers can match either the kind or the exact error
+// with errors.Is. Other errors mean the storage failed.
+var (
+	ErrNotFound = errors.New("NOT FOUND")
+	ErrConflict = errors.New("CONFLICT")
+	ErrInvalid  = errors.New("INVALID")
+)
+
+var (
+	ErrArticleNotFound       = fmt.Errorf("ARTICLE %w", ErrNotFound)
+	ErrCommentNotFound       = fmt.Errorf("COMMENT %w", ErrNotFound)
+	ErrParentCommentNotFound = fmt.Errorf("PARENT COMMENT %w", ErrNotFound)
+	ErrMediaNotFound         = fmt.Errorf("MEDIA %w", ErrNotFound)
+	ErrUserNotFound          = fmt.Errorf("USER %w", ErrNotFound)
+	// ErrEmailTaken is returned when a user is saved with the email of
+	// another user.
+	ErrEmailTaken = fmt.Errorf("EMAIL ALREADY TAKEN: %w", ErrConflict)
+	// ErrQuotaExceeded is returned when media would take the storage of its
+	// user over their quota.
+	ErrQuotaExceeded = fmt.Errorf("STORAGE QUOTA EXCEEDED: %w", ErrConflict)
+)
+
+// recordError maps a GORM error about a single record to notFound when the
+// record does not exist. Other errors are wrapped, so the cause is logged.
+func recordError(err error, notFound error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// uniqueViolation reports whether err is a PostgreSQL unique constraint
+// violation.
+func uniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,26 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/repositories/storagetest"
+)
+
+func TestLocalBucketRepository(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.BucketRepository {
+		return repositories.NewLocalBucketRepository(t.TempDir())
+	})
+}
+
+func TestLocalBucketRepositoryRejectsNamesOutsideTheBucket(t *testing.T) {
+	repo := repositories.NewLocalBucketRepository(t.TempDir())
+
+	for _, name := range []string{"../escape.png", "a/../../escape.png", "/abs.png", `a\b.png`, ""} {
+		if _, err := repo.StatObject(context.Background(), storagetest.Bucket, name); !errors.Is(err, repositories.ErrInvalidObjectName) {
+			t.Errorf("StatObject(%q) = %v, want ErrInvalidObjectName", name, err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/repositories/storagetest"
+)
+
+func TestMemoryBucketRepository(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.BucketRepository {
+		return repositories.NewMemoryBucketRepository()
+	})
+}
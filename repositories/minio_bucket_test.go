@@ -0,0 +1,70 @@
+package repositories_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aliftoriq/go-crud/repositories"
+	"github.com/aliftoriq/go-crud/repositories/storagetest"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// TestMinioBucketRepository runs against the MinIO server at MINIO_ENDPOINT,
+// e.g. localhost:9000 of docker-compose, with MINIO_ACCESS_KEY and
+// MINIO_SECRET_KEY. It creates storagetest.Bucket if needed and empties it
+// before every subtest.
+func TestMinioBucketRepository(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(os.Getenv("MINIO_ACCESS_KEY"), os.Getenv("MINIO_SECRET_KEY"), ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, storagetest.Bucket)
+	if err != nil {
+		t.Fatalf("BucketExists: %v", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, storagetest.Bucket, minio.MakeBucketOptions{}); err != nil {
+			t.Fatalf("MakeBucket: %v", err)
+		}
+	}
+
+	storagetest.Run(t, func(t *testing.T) repositories.BucketRepository {
+		emptyBucket(t, client)
+		return repositories.NewBucketRepository(client)
+	})
+}
+
+// emptyBucket removes the objects and the unfinished multipart uploads of
+// storagetest.Bucket.
+func emptyBucket(t *testing.T, client *minio.Client) {
+	ctx := context.Background()
+
+	for object := range client.ListObjects(ctx, storagetest.Bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			t.Fatalf("ListObjects: %v", object.Err)
+		}
+		if err := client.RemoveObject(ctx, storagetest.Bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			t.Fatalf("RemoveObject: %v", err)
+		}
+	}
+
+	for upload := range client.ListIncompleteUploads(ctx, storagetest.Bucket, "", true) {
+		if upload.Err != nil {
+			t.Fatalf("ListIncompleteUploads: %v", upload.Err)
+		}
+		if err := client.RemoveIncompleteUpload(ctx, storagetest.Bucket, upload.Key); err != nil {
+			t.Fatalf("RemoveIncompleteUpload: %v", err)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// Package storagetest is the conformance suite every BucketRepository backend
+// must pass. A backend runs it from its own test:
+//
+//	func TestLocalBucketRepository(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) repositories.BucketRepository {
+//			return repositories.NewLocalBucketRepository(t.TempDir())
+//		})
+//	}
+//
+// The MinIO backend needs a reachable server; its test is skipped unless
+// MINIO_ENDPOINT is set.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliftoriq/go-crud/repositories"
+)
+
+// Bucket is the bucket the suite stores its objects in.
+const Bucket = "storagetest"
+
+// partSize is the smallest part size S3 accepts for all but the last part.
+const partSize = 5 << 20
+
+// Run runs the conformance suite. newRepo is called once per subtest and must
+// return a repository with an empty Bucket.
+func Run(t *testing.T, newRepo func(t *testing.T) repositories.BucketRepository) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repositories.BucketRepository)
+	}{
+		{"PutGetStat", testPutGetStat},
+		{"Overwrite", testOverwrite},
+		{"Seek", testSeek},
+		{"Missing", testMissing},
+		{"SizeMismatch", testSizeMismatch},
+		{"ListObjects", testListObjects},
+		{"DeleteObject", testDeleteObject},
+		{"Presign", testPresign},
+		{"Multipart", testMultipart},
+		{"MultipartReplacePart", testMultipartReplacePart},
+		{"MultipartAbort", testMultipartAbort},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func testPutGetStat(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+	data := []byte("hello world")
+
+	put(t, repo, "a.png", data, "image/png")
+
+	if got := get(t, repo, "a.png"); !bytes.Equal(got, data) {
+		t.Fatalf("GetObject = %q, want %q", got, data)
+	}
+
+	info, err := repo.StatObject(ctx, Bucket, "a.png")
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if info.Key != "a.png" || info.Size != int64(len(data)) || info.ContentType != "image/png" {
+		t.Errorf("StatObject = %+v, want key a.png, size %d, type image/png", info, len(data))
+	}
+	if info.ETag == "" {
+		t.Error("StatObject returned an empty ETag")
+	}
+	if info.LastModified.IsZero() || time.Since(info.LastModified) > time.Hour {
+		t.Errorf("StatObject LastModified = %v, want about now", info.LastModified)
+	}
+
+	again, err := repo.StatObject(ctx, Bucket, "a.png")
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if again.ETag != info.ETag {
+		t.Errorf("ETag changed without a write: %q != %q", again.ETag, info.ETag)
+	}
+}
+
+func testOverwrite(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	put(t, repo, "a.png", []byte("first"), "image/png")
+	first, err := repo.StatObject(ctx, Bucket, "a.png")
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+
+	put(t, repo, "a.png", []byte("second version"), "image/jpeg")
+	second, err := repo.StatObject(ctx, Bucket, "a.png")
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+
+	if got := get(t, repo, "a.png"); string(got) != "second version" {
+		t.Errorf("GetObject = %q, want the new content", got)
+	}
+	if second.ContentType != "image/jpeg" || second.Size != int64(len("second version")) {
+		t.Errorf("StatObject = %+v, want the new type and size", second)
+	}
+	if second.ETag == first.ETag {
+		t.Error("ETag did not change with the content")
+	}
+}
+
+func testSeek(t *testing.T, repo repositories.BucketRepository) {
+	put(t, repo, "a.png", []byte("0123456789"), "image/png")
+
+	object, err := repo.GetObject(context.Background(), Bucket, "a.png")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	defer object.Close()
+
+	if _, err := object.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(object, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "456" {
+		t.Errorf("read %q after seeking to 4, want %q", buf, "456")
+	}
+
+	size, err := object.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if size != 10 {
+		t.Errorf("Seek to end = %d, want 10", size)
+	}
+}
+
+func testMissing(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	if _, err := repo.StatObject(ctx, Bucket, "missing.png"); !errors.Is(err, repositories.ErrObjectNotFound) {
+		t.Errorf("StatObject of a missing object = %v, want ErrObjectNotFound", err)
+	}
+
+	// Backends may fail when opening or, like MinIO, only on the first read.
+	object, err := repo.GetObject(ctx, Bucket, "missing.png")
+	if err == nil {
+		_, err = io.ReadAll(object)
+		object.Close()
+	}
+	if err == nil {
+		t.Error("reading a missing object succeeded")
+	}
+}
+
+func testSizeMismatch(t *testing.T, repo repositories.BucketRepository) {
+	err := repo.PutObject(context.Background(), Bucket, "a.png", strings.NewReader("short"), 100, "image/png")
+	if err == nil {
+		t.Fatal("PutObject with a wrong size succeeded")
+	}
+
+	if _, err := repo.StatObject(context.Background(), Bucket, "a.png"); !errors.Is(err, repositories.ErrObjectNotFound) {
+		t.Errorf("StatObject after a failed PutObject = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func testListObjects(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	for _, key := range []string{"b.png", "a.png", "variants/a.png/thumb.png", "variants/a.png/large.png", "variants/b.png/thumb.png"} {
+		put(t, repo, key, []byte(key), "image/png")
+	}
+
+	all, err := repo.ListObjects(ctx, Bucket, "")
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	want := []string{"a.png", "b.png", "variants/a.png/large.png", "variants/a.png/thumb.png", "variants/b.png/thumb.png"}
+	if got := keys(all); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListObjects = %v, want %v", got, want)
+	}
+	for _, info := range all {
+		if info.Size != int64(len(info.Key)) {
+			t.Errorf("ListObjects size of %s = %d, want %d", info.Key, info.Size, len(info.Key))
+		}
+	}
+
+	prefixed, err := repo.ListObjects(ctx, Bucket, "variants/a.png/")
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	want = []string{"variants/a.png/large.png", "variants/a.png/thumb.png"}
+	if got := keys(prefixed); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListObjects with prefix = %v, want %v", got, want)
+	}
+
+	none, err := repo.ListObjects(ctx, Bucket, "nothing/")
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if len(none) != 0 {
+		t.Errorf("ListObjects with an unused prefix = %v, want nothing", keys(none))
+	}
+}
+
+func testDeleteObject(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	put(t, repo, "a.png", []byte("a"), "image/png")
+	put(t, repo, "variants/a.png/thumb.png", []byte("t"), "image/png")
+
+	if err := repo.DeleteObject(ctx, Bucket, "variants/a.png/thumb.png"); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if _, err := repo.StatObject(ctx, Bucket, "variants/a.png/thumb.png"); !errors.Is(err, repositories.ErrObjectNotFound) {
+		t.Errorf("StatObject after DeleteObject = %v, want ErrObjectNotFound", err)
+	}
+	if _, err := repo.StatObject(ctx, Bucket, "a.png"); err != nil {
+		t.Errorf("DeleteObject removed another object: %v", err)
+	}
+
+	if err := repo.DeleteObject(ctx, Bucket, "missing.png"); err != nil {
+		t.Errorf("DeleteObject of a missing object = %v, want nil", err)
+	}
+}
+
+func testPresign(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+	put(t, repo, "a.png", []byte("a"), "image/png")
+
+	url, err := repo.PresignGetObject(ctx, Bucket, "a.png", time.Minute)
+	if errors.Is(err, repositories.ErrPresignNotSupported) {
+		t.Skip("backend does not support presigned URLs")
+	}
+	if err != nil || url == "" {
+		t.Errorf("PresignGetObject = %q, %v", url, err)
+	}
+
+	url, err = repo.PresignPutObject(ctx, Bucket, "b.png", time.Minute, "image/png", 1)
+	if err != nil || url == "" {
+		t.Errorf("PresignPutObject = %q, %v", url, err)
+	}
+}
+
+func testMultipart(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	uploadID, err := repo.NewMultipartUpload(ctx, Bucket, "big.png", "image/png")
+	if err != nil {
+		t.Fatalf("NewMultipartUpload: %v", err)
+	}
+
+	uploads, err := repo.ListIncompleteUploads(ctx, Bucket)
+	if err != nil {
+		t.Fatalf("ListIncompleteUploads: %v", err)
+	}
+	if !hasUpload(uploads, "big.png", uploadID) {
+		t.Errorf("ListIncompleteUploads = %+v, want upload %s", uploads, uploadID)
+	}
+
+	first := bytes.Repeat([]byte("a"), partSize)
+	second := []byte("the end")
+
+	// Parts may arrive in any order.
+	p2 := putPart(t, repo, "big.png", uploadID, 2, second)
+	p1 := putPart(t, repo, "big.png", uploadID, 1, first)
+	if p1.Size != int64(len(first)) || p2.Size != int64(len(second)) || p1.ETag == "" {
+		t.Errorf("PutObjectPart = %+v, %+v", p1, p2)
+	}
+
+	parts, err := repo.ListObjectParts(ctx, Bucket, "big.png", uploadID)
+	if err != nil {
+		t.Fatalf("ListObjectParts: %v", err)
+	}
+	if len(parts) != 2 || parts[0] != p1 || parts[1] != p2 {
+		t.Fatalf("ListObjectParts = %+v, want %+v", parts, []repositories.ObjectPart{p1, p2})
+	}
+
+	if _, err := repo.StatObject(ctx, Bucket, "big.png"); !errors.Is(err, repositories.ErrObjectNotFound) {
+		t.Errorf("StatObject before completing = %v, want ErrObjectNotFound", err)
+	}
+
+	if err := repo.CompleteMultipartUpload(ctx, Bucket, "big.png", uploadID, parts); err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+
+	if got := get(t, repo, "big.png"); !bytes.Equal(got, append(first, second...)) {
+		t.Errorf("GetObject after completing returned %d bytes, want %d", len(got), len(first)+len(second))
+	}
+
+	info, err := repo.StatObject(ctx, Bucket, "big.png")
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if info.ContentType != "image/png" {
+		t.Errorf("StatObject content type = %q, want the one the upload was started with", info.ContentType)
+	}
+
+	if _, err := repo.ListObjectParts(ctx, Bucket, "big.png", uploadID); !errors.Is(err, repositories.ErrUploadNotFound) {
+		t.Errorf("ListObjectParts after completing = %v, want ErrUploadNotFound", err)
+	}
+
+	uploads, err = repo.ListIncompleteUploads(ctx, Bucket)
+	if err != nil {
+		t.Fatalf("ListIncompleteUploads: %v", err)
+	}
+	if hasUpload(uploads, "big.png", uploadID) {
+		t.Error("completed upload is still listed as incomplete")
+	}
+}
+
+func testMultipartReplacePart(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	uploadID, err := repo.NewMultipartUpload(ctx, Bucket, "a.png", "image/png")
+	if err != nil {
+		t.Fatalf("NewMultipartUpload: %v", err)
+	}
+
+	putPart(t, repo, "a.png", uploadID, 1, []byte("broken"))
+	replaced := putPart(t, repo, "a.png", uploadID, 1, []byte("fixed"))
+
+	parts, err := repo.ListObjectParts(ctx, Bucket, "a.png", uploadID)
+	if err != nil {
+		t.Fatalf("ListObjectParts: %v", err)
+	}
+	if len(parts) != 1 || parts[0] != replaced {
+		t.Fatalf("ListObjectParts = %+v, want only %+v", parts, replaced)
+	}
+
+	if err := repo.CompleteMultipartUpload(ctx, Bucket, "a.png", uploadID, parts); err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	if got := get(t, repo, "a.png"); string(got) != "fixed" {
+		t.Errorf("GetObject = %q, want the replaced part", got)
+	}
+}
+
+func testMultipartAbort(t *testing.T, repo repositories.BucketRepository) {
+	ctx := context.Background()
+
+	uploadID, err := repo.NewMultipartUpload(ctx, Bucket, "a.png", "image/png")
+	if err != nil {
+		t.Fatalf("NewMultipartUpload: %v", err)
+	}
+	putPart(t, repo, "a.png", uploadID, 1, []byte("data"))
+
+	if err := repo.AbortMultipartUpload(ctx, Bucket, "a.png", uploadID); err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+
+	if _, err := repo.ListObjectParts(ctx, Bucket, "a.png", uploadID); !errors.Is(err, repositories.ErrUploadNotFound) {
+		t.Errorf("ListObjectParts after aborting = %v, want ErrUploadNotFound", err)
+	}
+	if _, err := repo.StatObject(ctx, Bucket, "a.png"); !errors.Is(err, repositories.ErrObjectNotFound) {
+		t.Errorf("StatObject after aborting = %v, want ErrObjectNotFound", err)
+	}
+
+	uploads, err := repo.ListIncompleteUploads(ctx, Bucket)
+	if err != nil {
+		t.Fatalf("ListIncompleteUploads: %v", err)
+	}
+	if hasUpload(uploads, "a.png", uploadID) {
+		t.Error("aborted upload is still listed as incomplete")
+	}
+}
+
+func put(t *testing.T, repo repositories.BucketRepository, key string, data []byte, contentType string) {
+	t.Helper()
+	if err := repo.PutObject(context.Background(), Bucket, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		t.Fatalf("PutObject %s: %v", key, err)
+	}
+}
+
+func get(t *testing.T, repo repositories.BucketRepository, key string) []byte {
+	t.Helper()
+	object, err := repo.GetObject(context.Background(), Bucket, key)
+	if err != nil {
+		t.Fatalf("GetObject %s: %v", key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return data
+}
+
+func putPart(t *testing.T, repo repositories.BucketRepository, key string, uploadID string, n int, data []byte) repositories.ObjectPart {
+	t.Helper()
+	part, err := repo.PutObjectPart(context.Background(), Bucket, key, uploadID, n, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("PutObjectPart %d: %v", n, err)
+	}
+	return part
+}
+
+func keys(objects []repositories.ObjectInfo) []string {
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+	return keys
+}
+
+func hasUpload(uploads []repositories.IncompleteUpload, key string, uploadID string) bool {
+	for _, upload := range uploads {
+		if upload.Key == key && upload.UploadID == uploadID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"context"
+
+	"github.com/aliftoriq/go-crud/repositories"
+)
+
+// Admit scans an upload stored under QuarantineObject(objectName). Clean
+// uploads are moved to objectName, where they can be served; anything else is
+// deleted. When the scan itself fails the upload stays in quarantine and the
+// error is returned, so the scan can be retried.
+func Admit(ctx context.Context, s Scanner, bucketRepo repositories.BucketRepository, bucketName string, objectName string) (Result, error) {
+	quarantined := QuarantineObject(objectName)
+
+	// Stat first: GetObject of MinIO does not report a missing object until
+	// it is read.
+	info, err := bucketRepo.StatObject(ctx, bucketName, quarantined)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result, err := scanObject(ctx, s, bucketRepo, bucketName, quarantined)
+	if err != nil || !result.Clean {
+		return result, err
+	}
+
+	if err := promote(ctx, bucketRepo, bucketName, quarantined, objectName, info); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// Check scans an image that is already stored under objectName, like the
+// images uploaded before uploads were scanned. An infected image is deleted.
+func Check(ctx context.Context, s Scanner, bucketRepo repositories.BucketRepository, bucketName string, objectName string) (Result, error) {
+	if _, err := bucketRepo.StatObject(ctx, bucketName, objectName); err != nil {
+		return Result{}, err
+	}
+	return scanObject(ctx, s, bucketRepo, bucketName, objectName)
+}
+
+// scanObject scans an object and deletes it when it is infected.
+func scanObject(ctx context.Context, s Scanner, bucketRepo repositories.BucketRepository, bucketName string, objectName string) (Result, error) {
+	object, err := bucketRepo.GetObject(ctx, bucketName, objectName)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := s.Scan(ctx, object)
+	object.Close()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !result.Clean {
+		return result, bucketRepo.DeleteObject(ctx, bucketName, objectName)
+	}
+	return result, nil
+}
+
+func promote(ctx context.Context, bucketRepo repositories.BucketRepository, bucketName string, from string, to string, info repositories.ObjectInfo) error {
+	object, err := bucketRepo.GetObject(ctx, bucketName, from)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	if err := bucketRepo.PutObject(ctx, bucketName, to, object, info.Size, info.ContentType); err != nil {
+		return err
+	}
+
+	return bucketRepo.DeleteObject(ctx, bucketName, from)
+}
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamAVChunkSize stays well below clamd's default StreamMaxLength.
+const clamAVChunkSize = 64 << 10
+
+// ClamAV scans content with clamd over TCP using the INSTREAM command.
+type ClamAV struct {
+	addr    string
+	timeout time.Duration
+}
+
+// NewClamAV returns a scanner for the clamd listening on addr, e.g.
+// "localhost:3310". A scan fails if it takes longer than timeout.
+func NewClamAV(addr string, timeout time.Duration) *ClamAV {
+	return &ClamAV{addr: addr, timeout: timeout}
+}
+
+func (s *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+
+	if err := streamToClamAV(conn, r); err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+
+	return parseClamAVReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// streamToClamAV sends r as INSTREAM chunks, each prefixed with its length,
+// followed by an empty chunk.
+func streamToClamAV(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+clamAVChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamAVReply parses replies like "stream: OK" and
+// "stream: Eicar-Signature FOUND".
+func parseClamAVReply(reply string) (Result, error) {
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		threat := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(threat, ": "); i >= 0 {
+			threat = threat[i+2:]
+		}
+		return Result{Threat: threat}, nil
+	case reply == "":
+		return Result{}, errors.New("clamav: empty reply")
+	default:
+		return Result{}, fmt.Errorf("clamav: %s", reply)
+	}
+}
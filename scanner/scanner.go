@@ -0,0 +1,59 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// QuarantinePrefix is where uploads are stored until they are scanned clean.
+const QuarantinePrefix = "quarantine/"
+
+// Result is the verdict of a scan.
+type Result struct {
+	Clean bool
+	// Threat names what was found when the content is not clean.
+	Threat string
+}
+
+// Scanner scans uploaded content for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// QuarantineObject returns the name an upload is stored under until it is
+// scanned clean.
+func QuarantineObject(objectName string) string {
+	return QuarantinePrefix + objectName
+}
+
+// NoOp is a Scanner that finds everything clean.
+type NoOp struct{}
+
+func (NoOp) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{Clean: true}, nil
+}
+
+// eicar is the standard antivirus test signature.
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// Fake is a Scanner for tests. It finds the EICAR test signature, like a real
+// scanner would, and fails with Err when it is set.
+type Fake struct {
+	Err error
+}
+
+func (f Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if bytes.Contains(data, eicar) {
+		return Result{Threat: "Eicar-Test-Signature"}, nil
+	}
+	return Result{Clean: true}, nil
+}
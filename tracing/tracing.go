@@ -0,0 +1,55 @@
+// Package tracing records OpenTelemetry traces of requests and of the
+// database queries, Redis commands and object storage calls made for them.
+//
+// Trace context is propagated in the W3C traceparent and tracestate headers,
+// so a request joins the trace of the client that sent it.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aliftoriq/go-crud/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// instrumentationName names the tracer of the spans this package creates.
+const instrumentationName = "github.com/aliftoriq/go-crud/tracing"
+
+// Setup installs the W3C propagator and a tracer provider that exports to
+// the configured exporter. The provider must be shut down to flush the last
+// spans. With the none exporter it returns nil and spans are not recorded.
+func Setup(ctx context.Context, cfg config.Tracing) (*sdktrace.TracerProvider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Error("tracing failed", "error", err)
+	}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider, nil
+}